@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/accuknox/accuknox-cli/preflight"
+	"github.com/spf13/cobra"
+)
+
+// doctorNamespace is the namespace of Cilium and KubeArmor
+var doctorNamespace string
+
+var doctorOptions = preflight.Options{
+	Cilium:          true,
+	KubeArmor:       true,
+	DiscoveryEngine: true,
+}
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check whether a Kubernetes Cluster is ready for KubeArmor, Cilium and Discovery-engine",
+	Long:  `Run the install preflight checks without modifying the cluster`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		doctorOptions.CiliumNamespace = doctorNamespace
+		doctorOptions.KubeArmorNamespace = doctorNamespace
+		report := preflight.Run(client, doctorOptions)
+		report.Print()
+		if report.Failed() {
+			return errors.New("preflight checks failed")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().StringVarP(&doctorNamespace, "namespace", "n", "kube-system", "Namespace for Cilium and KubeArmor resources")
+	doctorCmd.Flags().StringVar(&doctorOptions.DiscoveryEngineNamespace, "discovery-engine-namespace", "explorer", "Namespace for discovery-engine resources")
+}
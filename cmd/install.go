@@ -2,11 +2,15 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"time"
 
+	"github.com/accuknox/accuknox-cli/dryrun"
 	di "github.com/accuknox/accuknox-cli/install"
+	"github.com/accuknox/accuknox-cli/preflight"
+	"github.com/accuknox/accuknox-cli/profile"
 	"github.com/cilium/cilium-cli/defaults"
 	"github.com/cilium/cilium-cli/hubble"
 	ci "github.com/cilium/cilium-cli/install"
@@ -14,11 +18,20 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"golang.org/x/exp/slices"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
 var (
 	disable        []string
 	namespace      string
+	preflightOnly  bool
+	force          bool
+	dryRun         bool
+	output         string
+	outputDir      string
+	profileFile    string
+	deValuesFile   string
+	deFlags        = di.DefaultConfig()
 	installOptions ki.Options
 	params         = ci.Parameters{Writer: os.Stdout}
 	hparams        = hubble.Parameters{Writer: os.Stdout}
@@ -56,6 +69,10 @@ var installCmd = &cobra.Command{
 	Long:  `Install KubeArmor, Cilium and Discovery-engine in a Kubernetes Clusters`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 
+		if err := applyProfile(cmd); err != nil {
+			return err
+		}
+
 		//validate disable flag input
 		err := validateDisableFlagInput(disable)
 
@@ -63,9 +80,40 @@ var installCmd = &cobra.Command{
 			return err
 		}
 
+		if dryRun {
+			return renderManifests()
+		}
+		if output != "" || outputDir != "" {
+			return errors.New("--output and --output-dir require --dry-run")
+		}
+
+		report := preflight.Run(client, preflight.Options{
+			CiliumNamespace:          params.Namespace,
+			KubeArmorNamespace:       installOptions.Namespace,
+			DiscoveryEngineNamespace: diOptions.Namespace,
+			Cilium:                   !slices.Contains(disable, "cilium"),
+			KubeArmor:                !slices.Contains(disable, "kubearmor"),
+			DiscoveryEngine:          !slices.Contains(disable, "discoveryengine"),
+		})
+		if preflightOnly {
+			report.Print()
+			if report.Failed() {
+				return errors.New("preflight checks failed")
+			}
+			return nil
+		}
+		if report.Failed() || report.Warned() {
+			report.Print()
+		}
+		if report.Failed() {
+			if !force {
+				return errors.New("preflight checks failed, fix the failures above or re-run with --force")
+			}
+			log.Warn().Msg("preflight checks failed, continuing because of --force")
+		}
+
 		if !slices.Contains(disable, "cilium") {
 			// Install Cilium
-			params.Namespace = namespace
 			installer, err := ci.NewK8sInstaller(k8sClient, params)
 			if err != nil {
 				return err
@@ -78,11 +126,7 @@ var installCmd = &cobra.Command{
 			}
 
 			// Enable cilium hubble
-			hparams.Namespace = namespace
-			hparams.Relay = true
-			hparams.HelmValuesSecretName = defaults.HelmValuesSecretName
-			hparams.RedactHelmCertKeys = true
-			hparams.CreateCA = true
+			setHubbleParams()
 			h := hubble.NewK8sHubble(k8sClient, hparams)
 			if err := h.Enable(context.Background()); err != nil {
 				log.Error().Msgf("Unable to enable Hubble: %s", err.Error())
@@ -91,7 +135,6 @@ var installCmd = &cobra.Command{
 
 		if !slices.Contains(disable, "kubearmor") {
 			// Install KubeArmor
-			installOptions.Namespace = namespace
 			if err := ki.K8sInstaller(client, installOptions); err != nil {
 				return err
 			}
@@ -99,7 +142,6 @@ var installCmd = &cobra.Command{
 
 		if !slices.Contains(disable, "discoveryengine") {
 			// Install MySQL DB
-			installOptions.Namespace = namespace
 			/* disabling mysql since discovery-engine now uses sqlite3
 			if err := di.MySQLInstaller(client); err != nil {
 				return err
@@ -107,7 +149,6 @@ var installCmd = &cobra.Command{
 			*/
 
 			// Install dscovery-engine
-			diOptions.Namespace = namespace
 			if err := di.DiscoveryEngineInstaller(client, diOptions); err != nil {
 				return err
 			}
@@ -117,16 +158,211 @@ var installCmd = &cobra.Command{
 	},
 }
 
+// setHubbleParams sets the parameters used to enable hubble relay
+func setHubbleParams() {
+	hparams.Namespace = params.Namespace
+	hparams.Relay = true
+	hparams.HelmValuesSecretName = params.HelmValuesSecretName
+	hparams.RedactHelmCertKeys = true
+	hparams.CreateCA = true
+}
+
+// renderManifests writes every object the install would create without
+// modifying the cluster
+func renderManifests() error {
+	if output == "" {
+		output = "yaml"
+	}
+
+	var manifests []*dryrun.Manifest
+
+	if !slices.Contains(disable, "cilium") {
+		setHubbleParams()
+		m, err := dryrun.Cilium(k8sClient, params, hparams, os.Stderr)
+		if err != nil {
+			return err
+		}
+		manifests = append(manifests, m)
+	}
+
+	if !slices.Contains(disable, "kubearmor") {
+		m, err := dryrun.KubeArmor(client, installOptions, os.Stderr)
+		if err != nil {
+			return err
+		}
+		manifests = append(manifests, m)
+	}
+
+	if !slices.Contains(disable, "discoveryengine") {
+		m, err := dryrun.DiscoveryEngine(diOptions)
+		if err != nil {
+			return err
+		}
+		manifests = append(manifests, m)
+	}
+
+	return dryrun.Write(manifests, output, outputDir, os.Stdout)
+}
+
+// applyProfile sets the namespaces and, if a profile file is given, every
+// setting whose flag was not set explicitly from the profile
+func applyProfile(cmd *cobra.Command) error {
+	params.Namespace = namespace
+	installOptions.Namespace = namespace
+
+	if profileFile == "" {
+		return applyDiscoveryEngineConfig(cmd, nil)
+	}
+	p, err := profile.Load(profileFile)
+	if err != nil {
+		return err
+	}
+
+	// flags set on the command line win over the profile
+	unset := func(flag string) bool {
+		return !cmd.Flags().Changed(flag)
+	}
+	setString := func(flag string, dst *string, v string) {
+		if unset(flag) && v != "" {
+			*dst = v
+		}
+	}
+	setBool := func(flag string, dst *bool, v *bool) {
+		if unset(flag) && v != nil {
+			*dst = *v
+		}
+	}
+	setDuration := func(flag string, dst *time.Duration, v string) {
+		if unset(flag) && v != "" {
+			*dst = profile.Duration(v)
+		}
+	}
+
+	if unset("disable") {
+		disable = []string{}
+		if !profile.IsEnabled(p.Cilium.Enabled) {
+			disable = append(disable, "cilium")
+		}
+		if !profile.IsEnabled(p.KubeArmor.Enabled) {
+			disable = append(disable, "kubearmor")
+		}
+		if !profile.IsEnabled(p.DiscoveryEngine.Enabled) {
+			disable = append(disable, "discoveryengine")
+		}
+	}
+
+	// cilium
+	setString("namespace", &params.Namespace, p.Cilium.Namespace)
+	setString("version", &params.Version, p.Cilium.Version)
+	params.AgentImage = p.Cilium.AgentImage
+	params.OperatorImage = p.Cilium.OperatorImage
+	params.ClusterName = p.Cilium.ClusterName
+	if unset("cluster-id") && p.Cilium.ClusterID != 0 {
+		params.ClusterID = p.Cilium.ClusterID
+	}
+	setString("encryption", &params.Encryption, p.Cilium.Encryption)
+	if unset("node-encryption") && p.Cilium.NodeEncryption {
+		params.NodeEncryption = true
+	}
+	setBool("wait", &params.Wait, p.Cilium.Wait)
+	setDuration("wait-duration", &params.WaitDuration, p.Cilium.WaitDuration)
+	setBool("restart-unmanaged-pods", &params.RestartUnmanagedPods, p.Cilium.RestartUnmanagedPods)
+	setDuration("cilium-ready-timeout", &params.CiliumReadyTimeout, p.Cilium.CiliumReadyTimeout)
+	setBool("rollback", &params.Rollback, p.Cilium.Rollback)
+	setString("helm-values-secret-name", &params.HelmValuesSecretName, p.Cilium.HelmValuesSecretName)
+	hparams.RelayImage = p.Cilium.Hubble.RelayImage
+	if err := profile.ValidateEncryption(params.Encryption, params.NodeEncryption).ToAggregate(); err != nil {
+		return fmt.Errorf("invalid profile: %w", err)
+	}
+
+	// kubearmor
+	setString("namespace", &installOptions.Namespace, p.KubeArmor.Namespace)
+	setString("image", &installOptions.KubearmorImage, p.KubeArmor.Image)
+	setString("audit", &installOptions.Audit, p.KubeArmor.Audit)
+
+	// discovery-engine
+	setString("discovery-engine-namespace", &diOptions.Namespace, p.DiscoveryEngine.Namespace)
+	setString("discovery-engine-image", &diOptions.Image, p.DiscoveryEngine.Image)
+
+	return applyDiscoveryEngineConfig(cmd, p.DiscoveryEngine.Config)
+}
+
+// applyDiscoveryEngineConfig builds the discovery-engine config from the
+// defaults, the profile, the values file and the --de-* flags, in increasing
+// order of precedence
+func applyDiscoveryEngineConfig(cmd *cobra.Command, base *di.Config) error {
+	c := di.DefaultConfig()
+	if base != nil {
+		c = *base
+	}
+
+	if deValuesFile != "" {
+		if err := di.LoadConfigFile(deValuesFile, &c); err != nil {
+			return err
+		}
+	}
+
+	overrides := []struct {
+		flag string
+		dst  *string
+		src  string
+	}{
+		{"de-network-interval", &c.Application.Network.CronJobTimeInterval, deFlags.Application.Network.CronJobTimeInterval},
+		{"de-system-interval", &c.Application.System.CronJobTimeInterval, deFlags.Application.System.CronJobTimeInterval},
+		{"de-log-level", &c.Logging.Level, deFlags.Logging.Level},
+		{"de-hubble-url", &c.CiliumHubble.URL, deFlags.CiliumHubble.URL},
+		{"de-kubearmor-url", &c.KubeArmor.URL, deFlags.KubeArmor.URL},
+	}
+	for _, o := range overrides {
+		if cmd.Flags().Changed(o.flag) {
+			*o.dst = o.src
+		}
+	}
+
+	// hubble and kubearmor are reached in the namespaces they are installed in
+	c.SetEndpoints(params.Namespace, installOptions.Namespace)
+
+	if err := c.Validate(field.NewPath("config")).ToAggregate(); err != nil {
+		return fmt.Errorf("invalid discovery-engine config: %w", err)
+	}
+	diOptions.Config = &c
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(installCmd)
 
+	// profile flag
+	installCmd.Flags().StringVarP(&profileFile, "file", "f", "", "Install profile (YAML or JSON) with the settings of every component, flags override profile values")
+
 	// disable flag
 	installCmd.Flags().StringSliceVarP(&disable, "disable", "d", []string{}, "disable installing a program { cilium | kubearmor | discoveryengine }")
 
+	// preflight flags
+	installCmd.Flags().BoolVar(&preflightOnly, "preflight", false, "Only run preflight checks, do not install anything")
+	installCmd.Flags().BoolVar(&force, "force", false, "Install even if preflight checks fail")
+
+	// dry-run flags
+	installCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only render the manifests of every object the install would create, do not modify the cluster")
+	installCmd.Flags().StringVarP(&output, "output", "o", "", "Output format of the rendered manifests { yaml }")
+	installCmd.Flags().StringVar(&outputDir, "output-dir", "", "Write the rendered manifests to one file per component in this directory")
+
 	//kubearmor
 	installCmd.Flags().StringVarP(&installOptions.KubearmorImage, "image", "i", "kubearmor/kubearmor:stable", "Kubearmor daemonset image to use")
+	installCmd.Flags().StringVarP(&installOptions.Audit, "audit", "a", "", "Kubearmor Audit Posture Context [all,file,network,capabilities]")
 	installCmd.Flags().StringVarP(&namespace, "namespace", "n", "kube-system", "Namespace for resources")
 
+	//discovery-engine
+	installCmd.Flags().StringVar(&diOptions.Namespace, "discovery-engine-namespace", "explorer", "Namespace for discovery-engine resources")
+	installCmd.Flags().StringVar(&diOptions.Image, "discovery-engine-image", "accuknox/knoxautopolicy:stable", "Discovery-engine image to use")
+	installCmd.Flags().BoolVar(&diOptions.NoOverwrite, "no-overwrite", false, "Keep existing discovery-engine resources as they are instead of updating them")
+	installCmd.Flags().StringVar(&deValuesFile, "de-values", "", "YAML or JSON file with discovery-engine config values overriding the defaults")
+	installCmd.Flags().StringVar(&deFlags.Application.Network.CronJobTimeInterval, "de-network-interval", deFlags.Application.Network.CronJobTimeInterval, "Interval of network policy discovery (format: XhYmZs)")
+	installCmd.Flags().StringVar(&deFlags.Application.System.CronJobTimeInterval, "de-system-interval", deFlags.Application.System.CronJobTimeInterval, "Interval of system policy discovery (format: XhYmZs)")
+	installCmd.Flags().StringVar(&deFlags.Logging.Level, "de-log-level", deFlags.Logging.Level, "Discovery-engine log level { DEBUG | INFO | WARN | ERROR }")
+	installCmd.Flags().StringVar(&deFlags.CiliumHubble.URL, "de-hubble-url", "", "Hubble relay address used by discovery-engine (default hubble-relay.<namespace>.svc.cluster.local)")
+	installCmd.Flags().StringVar(&deFlags.KubeArmor.URL, "de-kubearmor-url", "", "KubeArmor address used by discovery-engine (default kubearmor.<namespace>.svc.cluster.local)")
+
 	//cilium
 	installCmd.Flags().StringVar(&params.Version, "version", defaults.Version, "Cilium version to install")
 	installCmd.Flags().StringVar(&params.BaseVersion, "base-version", defaults.Version,
@@ -4,14 +4,57 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
 	"github.com/accuknox/accuknox-cli/network"
+	"github.com/accuknox/accuknox-cli/portforward"
 
 	"github.com/kubearmor/kubearmor-client/log"
 	"github.com/spf13/cobra"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 )
 
 var logOptions log.Options
 var networkOptions network.Options
+var networkFilters network.FilterBuilder
+var networkTLSSecret string
+
+// networkHubbleNamespace is the namespace of hubble-relay, detected if empty
+var networkHubbleNamespace string
+
+// networkEnv are the environment variables read for the hubble-relay
+// connection flags that are not set
+var networkEnv = map[string]string{
+	"server":           "HUBBLE_SERVER",
+	"hubble-namespace": "HUBBLE_NAMESPACE",
+	"tls":              "HUBBLE_TLS",
+	"tls-ca-cert":      "HUBBLE_TLS_CA_CERT",
+	"tls-client-cert":  "HUBBLE_TLS_CLIENT_CERT",
+	"tls-client-key":   "HUBBLE_TLS_CLIENT_KEY",
+	"tls-server-name":  "HUBBLE_TLS_SERVER_NAME",
+	"tls-secret":       "HUBBLE_TLS_SECRET",
+	"timeout":          "HUBBLE_TIMEOUT",
+}
+
+// applyEnv sets the flags that were not given on the command line from their
+// environment variable
+func applyEnv(cmd *cobra.Command, env map[string]string) error {
+	for name, key := range env {
+		value, ok := os.LookupEnv(key)
+		if !ok || cmd.Flags().Changed(name) {
+			continue
+		}
+		if err := cmd.Flags().Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	return nil
+}
 
 // logCmd represents the log command
 var logCmd = &cobra.Command{
@@ -48,140 +91,132 @@ var networkCmd = &cobra.Command{
 
 		network.StopChan = make(chan struct{})
 
-		handleFilterFlags(cmd)
+		// interrupting the stream still prints the final stats summary
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sigs)
+		go func() {
+			<-sigs
+			close(network.StopChan)
+		}()
 
-		if err := network.StartHubbleRelay(networkOptions); err != nil {
+		if err := networkOptions.SetFilters(&networkFilters); err != nil {
 			return err
 		}
-		return nil
-	},
-}
-
-func handleFilterFlags(cmd *cobra.Command) {
-	// not
-	var isBlacklist bool = false
-	if flag, _ := cmd.Flags().GetBool("not"); flag {
-		isBlacklist = true
-	}
-
-	// ip
-	if flag, _ := cmd.Flags().GetString("from-ip"); flag != "" {
-		if isBlacklist {
-			isBlacklist = false
-			network.UpdateBlackList(&networkOptions, "from-ip", flag)
-		} else {
-			network.UpdateWhiteList(&networkOptions, "from-ip", flag)
-		}
-	}
-	if flag, _ := cmd.Flags().GetString("to-ip"); flag != "" {
-		if isBlacklist {
-			isBlacklist = false
-			network.UpdateBlackList(&networkOptions, "to-ip", flag)
-		} else {
-			network.UpdateWhiteList(&networkOptions, "to-ip", flag)
-		}
-	}
 
-	// pod
-	if flag, _ := cmd.Flags().GetString("from-pod"); flag != "" {
-		if isBlacklist {
-			isBlacklist = false
-			network.UpdateBlackList(&networkOptions, "from-pod", flag)
-		} else {
-			network.UpdateWhiteList(&networkOptions, "from-pod", flag)
+		if networkOptions.FromFile != "" {
+			return network.ReplayFlows(networkOptions)
 		}
 
-	}
-	if flag, _ := cmd.Flags().GetString("to-pod"); flag != "" {
-		if isBlacklist {
-			isBlacklist = false
-			network.UpdateBlackList(&networkOptions, "to-pod", flag)
-		} else {
-			network.UpdateWhiteList(&networkOptions, "to-pod", flag)
+		if err := applyEnv(cmd, networkEnv); err != nil {
+			return err
 		}
-	}
 
-	// fqdn
-	if flag, _ := cmd.Flags().GetString("from-fqdn"); flag != "" {
-		if isBlacklist {
-			isBlacklist = false
-			network.UpdateBlackList(&networkOptions, "from-fdqn", flag)
-		} else {
-			network.UpdateWhiteList(&networkOptions, "from-fqdn", flag)
+		// hubble-relay is looked for in the namespace it is deployed to, for
+		// its service and its default secret
+		relayNamespace := "kube-system"
+		if networkOptions.Server == "" || (networkOptions.TLS && !cmd.Flags().Changed("tls-secret")) {
+			ns, err := detectNamespace(networkHubbleNamespace, hubbleRelaySelector, "kube-system")
+			if err != nil {
+				return fmt.Errorf("unable to find hubble-relay: %w", err)
+			}
+			relayNamespace = ns
 		}
-	}
-	if flag, _ := cmd.Flags().GetString("to-fqdn"); flag != "" {
-		if isBlacklist {
-			isBlacklist = false
-			network.UpdateBlackList(&networkOptions, "to-fdqn", flag)
-		} else {
-			network.UpdateWhiteList(&networkOptions, "to-fqdn", flag)
+		if !cmd.Flags().Changed("tls-secret") {
+			networkTLSSecret = relayNamespace + "/" + network.TLSSecretName
 		}
-	}
 
-	// label
-	if flag, _ := cmd.Flags().GetString("from-label"); flag != "" {
-		if isBlacklist {
-			isBlacklist = false
-			network.UpdateBlackList(&networkOptions, "from-label", flag)
-		} else {
-			network.UpdateWhiteList(&networkOptions, "from-label", flag)
+		if networkOptions.TLS && networkTLSSecret != "" {
+			err := networkOptions.LoadTLSSecret(client, networkTLSSecret)
+			// the default secret is optional, the system CAs are used without it
+			if err != nil && (cmd.Flags().Changed("tls-secret") || !k8serrors.IsNotFound(err)) {
+				return fmt.Errorf("unable to load the certificates from secret %s: %w", networkTLSSecret, err)
+			}
 		}
-	}
-	if flag, _ := cmd.Flags().GetString("to-label"); flag != "" {
-		if isBlacklist {
-			isBlacklist = false
-			network.UpdateBlackList(&networkOptions, "to-label", flag)
-		} else {
-			network.UpdateWhiteList(&networkOptions, "to-label", flag)
-		}
-	}
 
-	// service
-	if flag, _ := cmd.Flags().GetString("from-service"); flag != "" {
-		if isBlacklist {
-			isBlacklist = false
-			network.UpdateBlackList(&networkOptions, "from-service", flag)
-		} else {
-			network.UpdateWhiteList(&networkOptions, "from-service", flag)
-		}
-	}
-	if flag, _ := cmd.Flags().GetString("to-service"); flag != "" {
-		if isBlacklist {
-			isBlacklist = false
-			network.UpdateBlackList(&networkOptions, "to-service", flag)
-		} else {
-			network.UpdateWhiteList(&networkOptions, "to-service", flag)
+		if networkOptions.Server == "" {
+			// the relay service listens on 443 when TLS is enabled
+			remotePort := 80
+			if networkOptions.TLS {
+				remotePort = 443
+			}
+			addr, tunnel, err := portforward.EnsureTunnel(client, network.DefaultServer, portforward.Options{
+				Namespace:  relayNamespace,
+				Service:    "hubble-relay",
+				RemotePort: remotePort,
+			})
+			if err != nil {
+				return err
+			}
+			if tunnel != nil {
+				defer tunnel.Close()
+			}
+			networkOptions.Server = addr
+			if networkOptions.TLSServerName == "" {
+				networkOptions.TLSServerName = network.DefaultRelayServerName
+			}
 		}
-	}
 
-	// port
-	if flag, _ := cmd.Flags().GetString("from-port"); flag != "" {
-		if isBlacklist {
-			isBlacklist = false
-			network.UpdateBlackList(&networkOptions, "from-port", flag)
-		} else {
-			network.UpdateWhiteList(&networkOptions, "from-port", flag)
-		}
-	}
-	if flag, _ := cmd.Flags().GetString("to-port"); flag != "" {
-		if isBlacklist {
-			isBlacklist = false
-			network.UpdateBlackList(&networkOptions, "to-port", flag)
-		} else {
-			network.UpdateWhiteList(&networkOptions, "to-port", flag)
+		if err := network.StartHubbleRelay(networkOptions); err != nil {
+			return err
 		}
+		return nil
+	},
+}
+
+// filterValue is a repeatable filter flag. pflag sets the values in the order
+// they are given on the command line, which is the order --not and --or apply in.
+type filterValue struct {
+	name   string
+	values []string
+}
+
+func (f *filterValue) Set(value string) error {
+	f.values = append(f.values, value)
+	if f.name == "filter" {
+		return networkFilters.Parse(value)
 	}
+	return networkFilters.Add(f.name, value)
+}
 
-	//verdict
-	if flag, _ := cmd.Flags().GetString("verdict"); flag != "" {
-		if isBlacklist {
-			isBlacklist = false
-			network.UpdateBlackList(&networkOptions, "verdict", flag)
-		} else {
-			network.UpdateWhiteList(&networkOptions, "verdict", flag)
-		}
+func (f *filterValue) String() string {
+	return strings.Join(f.values, ",")
+}
+
+func (f *filterValue) Type() string {
+	return "string"
+}
+
+// operatorValue is a --not or --or flag
+type operatorValue struct {
+	apply func() error
+}
+
+func (o *operatorValue) Set(value string) error {
+	if set, err := strconv.ParseBool(value); err != nil || !set {
+		return err
 	}
+	return o.apply()
+}
+
+func (o *operatorValue) String() string {
+	return "false"
+}
+
+func (o *operatorValue) Type() string {
+	return "bool"
+}
+
+func (o *operatorValue) IsBoolFlag() bool {
+	return true
+}
+
+func filterFlag(cmd *cobra.Command, name string, usage string) {
+	cmd.Flags().Var(&filterValue{name: name}, name, usage)
+}
+
+func operatorFlag(cmd *cobra.Command, name string, apply func() error, usage string) {
+	cmd.Flags().VarPF(&operatorValue{apply: apply}, name, "", usage).NoOptDefVal = "true"
 }
 
 func init() {
@@ -205,37 +240,87 @@ func init() {
 	appCmd.Flags().Uint32Var(&logOptions.Limit, "limit", 0, "number of logs you want to see")
 
 	networkCmd.Flags().BoolVarP(&networkOptions.Follow, "follow", "f", false, "Follow flows output")
-
-	// filter flags
+	networkCmd.Flags().StringVarP(&networkOptions.Output, "output", "o", network.OutputCompact, "Output format of the flows {compact|dict|json|jsonl|yaml}")
+	networkCmd.Flags().StringVar(&networkOptions.Since, "since", "", "Show flows since the given time, as an RFC3339 timestamp or relative to now (e.g. 5m, 1h)")
+	networkCmd.Flags().StringVar(&networkOptions.Until, "until", "", "Show flows until the given time, as an RFC3339 timestamp or relative to now (e.g. 5m, 1h)")
+	networkCmd.Flags().Uint64Var(&networkOptions.Last, "last", 0, "Show the newest N flows (20 by default when no time window is given)")
+	networkCmd.Flags().Uint64Var(&networkOptions.First, "first", 0, "Show the oldest N flows, oldest first")
+	networkCmd.Flags().BoolVar(&networkOptions.Stats, "stats", false, "Count the flows by source, destination, verdict, drop reason and L7 protocol instead of printing them")
+	networkCmd.Flags().DurationVar(&networkOptions.StatsInterval, "stats-interval", network.DefaultStatsInterval, "Refresh interval of the --stats table")
+	networkCmd.Flags().IntVar(&networkOptions.StatsTop, "top", 10, "Number of rows of the --stats tables")
+	networkCmd.Flags().StringVar(&networkOptions.Record, "record", "", "Record the flows to the given file, one JSON object per line")
+	networkCmd.Flags().StringVar(&networkOptions.FromFile, "from-file", "", "Replay the flows recorded with --record from the given file (- for stdin) instead of connecting to hubble-relay")
+
+	// hubble-relay connection
+	networkCmd.Flags().StringVar(&networkOptions.Server, "server", "", "Address of hubble-relay, a port-forward to the hubble-relay service is opened if not set [$HUBBLE_SERVER]")
+	networkCmd.Flags().StringVar(&networkHubbleNamespace, "hubble-namespace", "", "Namespace of hubble-relay, detected from the hubble-relay deployment if not set [$HUBBLE_NAMESPACE]")
+	networkCmd.Flags().BoolVar(&networkOptions.TLS, "tls", false, "Connect to hubble-relay with TLS [$HUBBLE_TLS]")
+	networkCmd.Flags().StringVar(&networkOptions.TLSCACert, "tls-ca-cert", "", "Path of the CA certificate of hubble-relay [$HUBBLE_TLS_CA_CERT]")
+	networkCmd.Flags().StringVar(&networkOptions.TLSClientCert, "tls-client-cert", "", "Path of the client certificate for mTLS [$HUBBLE_TLS_CLIENT_CERT]")
+	networkCmd.Flags().StringVar(&networkOptions.TLSClientKey, "tls-client-key", "", "Path of the client key for mTLS [$HUBBLE_TLS_CLIENT_KEY]")
+	networkCmd.Flags().StringVar(&networkOptions.TLSServerName, "tls-server-name", "", "Server name to verify the certificate of hubble-relay against [$HUBBLE_TLS_SERVER_NAME]")
+	networkCmd.Flags().StringVar(&networkTLSSecret, "tls-secret", "", "Secret ([namespace/]name) to load the CA and client certificate from when they are not given as files (default "+network.TLSSecretName+" in the namespace of hubble-relay) [$HUBBLE_TLS_SECRET]")
+	networkCmd.Flags().DurationVar(&networkOptions.Timeout, "timeout", network.DefaultTimeout, "Timeout of the connection to hubble-relay [$HUBBLE_TIMEOUT]")
+
+	// filter flags, every filter flag can be repeated. Filters are AND'd
+	// unless separated by --or, values of the same filter are OR'd.
 
 	// ip
-	networkCmd.Flags().String("from-ip", "", "Show all flows originating at the given IP address.")
-	networkCmd.Flags().String("to-ip", "", "Show all flows destined to the given IP address.")
+	filterFlag(networkCmd, "from-ip", "Show all flows originating at the given IP address.")
+	filterFlag(networkCmd, "to-ip", "Show all flows destined to the given IP address.")
 
 	// pod
-	networkCmd.Flags().String("from-pod", "", "Show all flows originating at the given pod name (e.g. \"/*.kubearmor.io\").")
-	networkCmd.Flags().String("to-pod", "", "Show all flows destined to the given fully qualified domain name (e.g. \"/*.kubearmor.io\").")
+	filterFlag(networkCmd, "from-pod", "Show all flows originating at the given pod name (e.g. \"/*.kubearmor.io\").")
+	filterFlag(networkCmd, "to-pod", "Show all flows destined to the given fully qualified domain name (e.g. \"/*.kubearmor.io\").")
 
 	// fqdn
-	networkCmd.Flags().String("from-fqdn", "", "Show all flows originating at the given fully qualified domain name (e.g. \"/*.kubearmor.io\").")
-	networkCmd.Flags().String("to-fqdn", "", "Show all flows destined to the given fully qualified domain name (e.g. \"/*.kubearmor.io\").")
+	filterFlag(networkCmd, "from-fqdn", "Show all flows originating at the given fully qualified domain name (e.g. \"/*.kubearmor.io\").")
+	filterFlag(networkCmd, "to-fqdn", "Show all flows destined to the given fully qualified domain name (e.g. \"/*.kubearmor.io\").")
 
 	// label
-	networkCmd.Flags().String("from-label", "", "Show all flows originating at the given lebel.")
-	networkCmd.Flags().String("to-label", "", "Show all flows destined to the given label")
+	filterFlag(networkCmd, "from-label", "Show all flows originating at the given lebel.")
+	filterFlag(networkCmd, "to-label", "Show all flows destined to the given label")
 
 	//service
-	networkCmd.Flags().String("from-service", "", "Show all flows originating in the given service. ([namespace/]<svc-name>)")
-	networkCmd.Flags().String("to-service", "", "Show all flows destined to the given service. ([namespace/]<svc-name>)")
+	filterFlag(networkCmd, "from-service", "Show all flows originating in the given service. ([namespace/]<svc-name>)")
+	filterFlag(networkCmd, "to-service", "Show all flows destined to the given service. ([namespace/]<svc-name>)")
 
 	// port
-	networkCmd.Flags().String("from-port", "", "Show all flows originating at the given port.")
-	networkCmd.Flags().String("to-port", "", "Show all flows destined to the given port.")
+	filterFlag(networkCmd, "from-port", "Show all flows originating at the given port.")
+	filterFlag(networkCmd, "to-port", "Show all flows destined to the given port.")
+
+	// identity
+	filterFlag(networkCmd, "from-identity", "Show all flows originating at the given security identity (numeric or reserved name such as world).")
+	filterFlag(networkCmd, "to-identity", "Show all flows destined to the given security identity (numeric or reserved name such as world).")
+	filterFlag(networkCmd, "identity", "Show all flows related to the given security identity (numeric or reserved name such as world).")
 
 	//verdict
-	networkCmd.Flags().String("verdict", "", "Show all flows with given verdict. {VERDICT_UNKNOWN|FORWARDED|DROPPED|ERROR|AUDIT}")
+	filterFlag(networkCmd, "verdict", "Show all flows with given verdict. {VERDICT_UNKNOWN|FORWARDED|DROPPED|ERROR|AUDIT}")
+
+	// http
+	filterFlag(networkCmd, "http-status", "Show only flows which match the given HTTP status code prefix (e.g. \"404\", \"5+\").")
+	filterFlag(networkCmd, "http-method", "Show only flows which match the given HTTP method (e.g. \"GET\").")
+	filterFlag(networkCmd, "http-path", "Show only flows which match the given HTTP path regular expression (e.g. \"/api/.+\").")
+
+	// transport
+	filterFlag(networkCmd, "tcp-flag", "Show only flows which match the given TCP flags (e.g. \"SYN,ACK\"). {FIN|SYN|RST|PSH|ACK|URG|ECE|CWR|NS}")
+	filterFlag(networkCmd, "ip-version", "Show only IPv4 or IPv6 flows. {v4|v6}")
+	filterFlag(networkCmd, "protocol", "Show only flows which match the given L4/L7 protocol. {tcp|udp|icmp|http|dns|kafka}")
+
+	// node
+	filterFlag(networkCmd, "nodename", "Show all flows which match the given node name (e.g. \"k8s*\", \"cluster/node\").")
+
+	// type
+	filterFlag(networkCmd, "type", "Show only flows of the given event type, optionally with a sub type (e.g. \"trace:to-endpoint\"). {trace|drop|l7|policy-verdict|capture}")
+
+	// dns
+	filterFlag(networkCmd, "dns-query", "Show all flows which match the given DNS query regular expression (e.g. \"*.kubearmor.io\").")
+
+	// query
+	filterFlag(networkCmd, "filter", "Filter query combining the filters above (e.g. \"from-pod=default/web and verdict=DROPPED or to-pod=default/db\").")
 
-	// not
-	networkCmd.Flags().Bool("not", false, "reverse the effect of a flow control flag.")
+	// not, or
+	operatorFlag(networkCmd, "not", networkFilters.Not, "reverse the effect of the next filter flag, can not be combined with --or.")
+	operatorFlag(networkCmd, "or", networkFilters.Or, "start a new group of filters, flows matching any group are shown.")
 
 }
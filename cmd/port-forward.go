@@ -3,11 +3,38 @@ package cmd
 import (
 	"errors"
 	"fmt"
-	"os/exec"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
+	"github.com/accuknox/accuknox-cli/portforward"
 	"github.com/spf13/cobra"
 )
 
+var (
+	pfAddresses []string
+
+	karmorPFOptions = portforward.Options{
+		Namespace:  "kube-system",
+		Service:    "kubearmor",
+		LocalPort:  32767,
+		RemotePort: 32767,
+	}
+	ciliumPFOptions = portforward.Options{
+		Namespace:  "kube-system",
+		Service:    "hubble-relay",
+		LocalPort:  4245,
+		RemotePort: 80,
+	}
+	// the namespace of discovery-engine is detected unless given
+	dEnginePFOptions = portforward.Options{
+		Service:    "knoxautopolicy",
+		LocalPort:  9089,
+		RemotePort: 9089,
+	}
+)
+
 // portForwardCmd represents the accuknox port-forward command
 var portForwardCmd = &cobra.Command{
 	Use:   "port-forward",
@@ -28,26 +55,9 @@ var karmorCmd = &cobra.Command{
 	Short: "port-forward KubeArmor in a Kubernetes Cluster",
 	Long:  `port-forward KubeArmor relay port to local machine in a Kubernetes Clusters`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-
-		cmdArgs := []string{
-			"-n",
-			"kube-system",
-			"port-forward",
-			"service/kubearmor",
-			"--address",
-			"0.0.0.0",
-			"--address",
-			"::",
-			"32767:32767"}
-		pfCmd := exec.Command("kubectl", cmdArgs...)
-
-		bytes, err := pfCmd.CombinedOutput()
-
-		if err != nil {
-			return errors.New("Unable to port-forward kubearmor: " + err.Error())
+		if err := runPortForward(karmorPFOptions); err != nil {
+			return fmt.Errorf("unable to port-forward kubearmor: %w", err)
 		}
-
-		fmt.Println(string(bytes))
 		return nil
 	},
 }
@@ -58,28 +68,9 @@ var ciliumCmd = &cobra.Command{
 	Short: "port-forward Cilium in a Kubernetes Cluster",
 	Long:  `port-forward Cilium hubble-relay port to local machine in a Kubernetes Clusters`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-
-		cmdArgs := []string{
-			"-n",
-			"kube-system",
-			"port-forward",
-			"service/hubble-relay",
-			"--address",
-			"0.0.0.0",
-			"--address",
-			"::",
-			"4245:80"}
-
-		pfCmd := exec.Command("kubectl", cmdArgs...)
-
-		bytes, err := pfCmd.CombinedOutput()
-
-		if err != nil {
-			return errors.New("Unable to port-forward cilium: " + err.Error())
+		if err := runPortForward(ciliumPFOptions); err != nil {
+			return fmt.Errorf("unable to port-forward cilium: %w", err)
 		}
-
-		fmt.Println(string(bytes))
-
 		return nil
 	},
 }
@@ -90,36 +81,150 @@ var dEngineCmd = &cobra.Command{
 	Short: "port-forward Discovery-engine in a Kubernetes Cluster",
 	Long:  `port-forward Discovery-engine in a Kubernetes Clusters`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		o := dEnginePFOptions
+		ns, err := discoveryEngineNamespace(o.Namespace)
+		if err != nil {
+			return fmt.Errorf("unable to port-forward discovery engine: %w", err)
+		}
+		o.Namespace = ns
+		if err := runPortForward(o); err != nil {
+			return fmt.Errorf("unable to port-forward discovery engine: %w", err)
+		}
+		return nil
+	},
+}
 
-		cmdArgs := []string{
-			"-n",
-			"explorer",
-			"port-forward",
-			"service/knoxautopolicy",
-			"--address",
-			"0.0.0.0",
-			"--address",
-			"::",
-			"9089:9089"}
-
-		pfCmd := exec.Command("kubectl", cmdArgs...)
-
-		bytes, err := pfCmd.CombinedOutput()
+// accuknox port-forward all
+var pfAllCmd = &cobra.Command{
+	Use:   "all",
+	Short: "port-forward KubeArmor, Cilium and Discovery-engine together",
+	Long:  `port-forward KubeArmor relay, Cilium hubble-relay and Discovery-engine concurrently, reconnecting any tunnel whose pod restarts`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		components := map[string]portforward.Options{
+			"kubearmor": karmorPFOptions,
+			"cilium":    ciliumPFOptions,
+		}
+		total := len(components) + 1
+		failed := 0
+		if ns, err := discoveryEngineNamespace(dEnginePFOptions.Namespace); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to port-forward discovery engine: %s\n", err.Error())
+			failed++
+		} else {
+			o := dEnginePFOptions
+			o.Namespace = ns
+			components["discovery engine"] = o
+		}
 
-		if err != nil {
-			return errors.New("Unable to port-forward discovery engine: " + err.Error())
+		stopChan := make(chan struct{})
+		go func() {
+			waitForInterrupt()
+			fmt.Println("Stopping port-forward...")
+			close(stopChan)
+		}()
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		for name, o := range components {
+			o.Addresses = pfAddresses
+			o.Out = os.Stdout
+			o.ErrOut = os.Stderr
+
+			wg.Add(1)
+			go func(name string, o portforward.Options) {
+				defer wg.Done()
+				if err := portforward.Supervise(client, o, stopChan); err != nil {
+					fmt.Fprintf(os.Stderr, "unable to port-forward %s: %s\n", name, err.Error())
+					mu.Lock()
+					failed++
+					mu.Unlock()
+				}
+			}(name, o)
 		}
+		wg.Wait()
 
-		fmt.Println(string(bytes))
+		if failed == total {
+			return errors.New("unable to port-forward any component")
+		}
 		return nil
 	},
 }
 
+// discoveryEngineSelector labels the discovery-engine deployment
+const discoveryEngineSelector = "deployment=knoxautopolicy"
+
+// hubbleRelaySelector labels the hubble-relay deployment
+const hubbleRelaySelector = "k8s-app=hubble-relay"
+
+// detectNamespace returns the namespace given or else the one of the
+// deployment matching the selector, fallback if there is none
+func detectNamespace(namespace, selector, fallback string) (string, error) {
+	if namespace != "" {
+		return namespace, nil
+	}
+	ns, err := portforward.DetectNamespace(client, selector)
+	if err != nil {
+		return "", err
+	}
+	if ns == "" {
+		return fallback, nil
+	}
+	return ns, nil
+}
+
+// discoveryEngineNamespace returns the namespace given or else the one
+// discovery-engine is deployed to, explorer if it is not found
+func discoveryEngineNamespace(namespace string) (string, error) {
+	return detectNamespace(namespace, discoveryEngineSelector, "explorer")
+}
+
+// runPortForward keeps the tunnel up, reconnecting on pod restarts, until
+// interrupted
+func runPortForward(o portforward.Options) error {
+	o.Addresses = pfAddresses
+	o.Out = os.Stdout
+	o.ErrOut = os.Stderr
+
+	stopChan := make(chan struct{})
+	go func() {
+		waitForInterrupt()
+		fmt.Println("Stopping port-forward...")
+		close(stopChan)
+	}()
+
+	fmt.Printf("Port-forwarding service/%s in namespace %s, press Ctrl-C to stop\n", o.Service, o.Namespace)
+	return portforward.Supervise(client, o, stopChan)
+}
+
+func waitForInterrupt() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	<-sigChan
+	signal.Stop(sigChan)
+}
+
+func addPortForwardFlags(cmd *cobra.Command, o *portforward.Options) {
+	cmd.Flags().StringVarP(&o.Namespace, "namespace", "n", o.Namespace, "Namespace of the service")
+	cmd.Flags().IntVar(&o.LocalPort, "local-port", o.LocalPort, "Local port to listen on (0 picks a random port)")
+}
+
 func init() {
 	rootCmd.AddCommand(portForwardCmd)
 
 	portForwardCmd.AddCommand(karmorCmd)
 	portForwardCmd.AddCommand(ciliumCmd)
 	portForwardCmd.AddCommand(dEngineCmd)
+	portForwardCmd.AddCommand(pfAllCmd)
+
+	portForwardCmd.PersistentFlags().StringSliceVar(&pfAddresses, "address", []string{"localhost"}, "Addresses to listen on, e.g. --address 0.0.0.0 --address :: to listen on every interface")
+
+	addPortForwardFlags(karmorCmd, &karmorPFOptions)
+	addPortForwardFlags(ciliumCmd, &ciliumPFOptions)
+	addPortForwardFlags(dEngineCmd, &dEnginePFOptions)
 
+	pfAllCmd.Flags().StringVar(&karmorPFOptions.Namespace, "kubearmor-namespace", karmorPFOptions.Namespace, "Namespace of the KubeArmor relay service")
+	pfAllCmd.Flags().IntVar(&karmorPFOptions.LocalPort, "kubearmor-local-port", karmorPFOptions.LocalPort, "Local port for KubeArmor relay")
+	pfAllCmd.Flags().StringVar(&ciliumPFOptions.Namespace, "cilium-namespace", ciliumPFOptions.Namespace, "Namespace of the hubble-relay service")
+	pfAllCmd.Flags().IntVar(&ciliumPFOptions.LocalPort, "cilium-local-port", ciliumPFOptions.LocalPort, "Local port for hubble-relay")
+	pfAllCmd.Flags().StringVar(&dEnginePFOptions.Namespace, "discovery-engine-namespace", "", "Namespace of the Discovery-engine service, detected if not set")
+	pfAllCmd.Flags().IntVar(&dEnginePFOptions.LocalPort, "discovery-engine-local-port", dEnginePFOptions.LocalPort, "Local port for Discovery-engine")
 }
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/accuknox/accuknox-cli/status"
+	"github.com/spf13/cobra"
+)
+
+var statusOptions status.Options
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Report the health of KubeArmor, Cilium and Discovery-engine",
+	Long:  `Report desired/ready/available counts, images, restarts and recent warning events of KubeArmor, Cilium and Discovery-engine in a Kubernetes Cluster`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := status.PrintStatus(client, statusOptions); err != nil {
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().StringVarP(&statusOptions.Namespace, "namespace", "n", "kube-system", "Namespace of Cilium and KubeArmor")
+	statusCmd.Flags().StringVar(&statusOptions.DiscoveryEngineNamespace, "discovery-engine-namespace", "explorer", "Namespace of Discovery-engine")
+	statusCmd.Flags().StringVarP(&statusOptions.Output, "output", "o", "", "Output format {json}")
+	statusCmd.Flags().BoolVar(&statusOptions.Wait, "wait", false, "Wait until all installed components are ready")
+	statusCmd.Flags().DurationVar(&statusOptions.WaitDuration, "wait-duration", 5*time.Minute, "Maximum time to wait for components to become ready")
+}
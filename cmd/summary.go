@@ -4,18 +4,74 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/accuknox/accuknox-cli/portforward"
 	"github.com/accuknox/accuknox-cli/summary"
+	opb "github.com/accuknox/auto-policy-discovery/src/protobuf/v1/observability"
 	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
 )
 
 var summaryOptions summary.Options
 
+// summaryDENamespace is the namespace of the discovery engine service the
+// port-forward is opened to
+var summaryDENamespace string
+
 // summaryCmd represents the summary command
 var summaryCmd = &cobra.Command{
 	Use:   "summary",
 	Short: "Policy summary from discovery engine",
-	Long:  `Policy summary from discovery engine`,
+	Long: `Policy summary from discovery engine
+
+The summary of every pod lists its processes, file-system accesses, network
+connections, ingress and egress connections and server connections. It is
+printed as tables by default, or as JSON/YAML LogsResponse objects, CSV with
+one section (or one file with --output-dir) per table type, or a markdown or
+HTML report.
+
+The summaries can be narrowed down to some pods, table types, statuses or
+recent entries, e.g. the pods with denied file accesses in the last hour:
+
+  accuknox summary --type file --status deny --since 1h
+
+The summaries can be saved with --save and compared later on with
+"accuknox summary diff". The snapshot holds every pod and entry of the labels
+and namespace, --pod, --type, --status and --since being applied when
+comparing it.
+
+With --watch the tables are refreshed every --interval, the rows that are new
+since the previous refresh are marked with "+" and the rows whose count
+changed with "~".
+
+Discovery engine is reached through a port-forward to its service unless its
+address is given with --server or the DISCOVERY_SERVICE environment variable.
+The namespace of the service is detected from the discovery engine deployment
+unless given with --discovery-engine-namespace.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if summaryOptions.Watch {
+			// interrupting the watch closes the port-forward
+			summary.StopChan = make(chan struct{})
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+			defer signal.Stop(sigs)
+			go func() {
+				<-sigs
+				close(summary.StopChan)
+			}()
+		}
+
+		closeTunnel, err := summaryTunnel()
+		if err != nil {
+			return err
+		}
+		defer closeTunnel()
+
 		if err := summary.StartSummary(summaryOptions); err != nil {
 			return err
 		}
@@ -23,8 +79,125 @@ var summaryCmd = &cobra.Command{
 	},
 }
 
+var summaryDiffOutput string
+
+// summaryDiffCmd compares two snapshots of the summaries
+var summaryDiffCmd = &cobra.Command{
+	Use:   "diff OLD [NEW]",
+	Short: "Compare summary snapshots",
+	Long: `Compare two summary snapshots saved with --save, or a snapshot with the
+live summary when NEW is not given.
+
+The processes, file-system accesses, network destinations, ingress and egress
+peers and server connections that appeared or disappeared are listed per
+workload, the pods being matched by their name without the suffixes added by
+their Deployment, DaemonSet or Job so that redeployed pods are compared.
+The command fails when new DENY or AUDIT entries appeared, so that it can be
+used to detect behavioural drift in CI.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !slices.Contains(summary.DiffOutputs, summaryDiffOutput) {
+			return fmt.Errorf("invalid output format %q, expected one of %s", summaryDiffOutput, strings.Join(summary.DiffOutputs, "|"))
+		}
+
+		before, err := summary.LoadSnapshot(args[0])
+		if err != nil {
+			return err
+		}
+		if before, err = summary.Select(summaryOptions, before); err != nil {
+			return err
+		}
+
+		var after []*opb.LogsResponse
+		if len(args) == 2 {
+			if after, err = summary.LoadSnapshot(args[1]); err != nil {
+				return err
+			}
+			if after, err = summary.Select(summaryOptions, after); err != nil {
+				return err
+			}
+		} else {
+			closeTunnel, err := summaryTunnel()
+			if err != nil {
+				return err
+			}
+			defer closeTunnel()
+			if after, err = summary.FetchSummary(summaryOptions); err != nil {
+				return err
+			}
+		}
+
+		changes := summary.Diff(before, after)
+		if err := summary.WriteDiff(os.Stdout, summaryDiffOutput, changes); err != nil {
+			return err
+		}
+		if n := summary.NewViolations(changes); n > 0 {
+			return fmt.Errorf("%d new DENY/AUDIT entries", n)
+		}
+		return nil
+	},
+}
+
+// summaryTunnel opens a port-forward to discovery engine unless its address
+// is given
+func summaryTunnel() (func(), error) {
+	if _, ok := os.LookupEnv("DISCOVERY_SERVICE"); ok || summaryOptions.GRPC != "" {
+		return func() {}, nil
+	}
+	ns, err := discoveryEngineNamespace(summaryDENamespace)
+	if err != nil {
+		return nil, err
+	}
+	addr, tunnel, err := portforward.EnsureTunnel(client, summary.DefaultServer, portforward.Options{
+		Namespace:  ns,
+		Service:    "knoxautopolicy",
+		RemotePort: 9089,
+	})
+	if err != nil {
+		return nil, err
+	}
+	summaryOptions.GRPC = addr
+	if tunnel == nil {
+		return func() {}, nil
+	}
+	return func() { tunnel.Close() }, nil
+}
+
 func init() {
 	rootCmd.AddCommand(summaryCmd)
-	summaryCmd.Flags().StringVar(&summaryOptions.Labels, "labels", "", "Labels for resources")
-	summaryCmd.Flags().StringVarP(&summaryOptions.Namespace, "namespace", "n", "", "Namespace for resources")
+	summaryCmd.AddCommand(summaryDiffCmd)
+
+	// the selection of the summaries applies to the snapshots compared too
+	summaryCmd.PersistentFlags().StringVar(&summaryOptions.Labels, "labels", "", "Labels for resources")
+	summaryCmd.PersistentFlags().StringVarP(&summaryOptions.Namespace, "namespace", "n", "", "Namespace for resources")
+	summaryCmd.PersistentFlags().StringSliceVar(&summaryOptions.Pods, "pod", nil, "Show the pods matching these names, shell patterns are accepted")
+	summaryCmd.PersistentFlags().StringSliceVar(&summaryOptions.Types, "type", nil, "Show these table types: "+strings.Join(summary.Types, "|"))
+	summaryCmd.PersistentFlags().StringSliceVar(&summaryOptions.Status, "status", nil, "Show the entries with these statuses: "+strings.Join(summary.Statuses, "|"))
+	summaryCmd.PersistentFlags().StringVar(&summaryOptions.Since, "since", "", "Show the entries updated since a RFC3339 time or a duration back from now (e.g. 1h)")
+
+	// connection to discovery engine, used by the live diff too
+	summaryCmd.PersistentFlags().StringVar(&summaryOptions.GRPC, "server", "", "Address of discovery engine, a port-forward to its service is opened if not set [$DISCOVERY_SERVICE]")
+	summaryCmd.PersistentFlags().StringVar(&summaryOptions.GRPC, "gRPC", "", "Alias of --server")
+	summaryCmd.PersistentFlags().StringVar(&summaryDENamespace, "discovery-engine-namespace", "", "Namespace of the discovery engine service to port-forward to, detected if not set")
+	summaryCmd.PersistentFlags().BoolVar(&summaryOptions.TLS, "tls", false, "Connect to discovery engine with TLS")
+	summaryCmd.PersistentFlags().StringVar(&summaryOptions.TLSCACert, "tls-ca-cert", "", "Path of the CA certificate of discovery engine")
+	summaryCmd.PersistentFlags().StringVar(&summaryOptions.TLSClientCert, "tls-client-cert", "", "Path of the client certificate for mTLS")
+	summaryCmd.PersistentFlags().StringVar(&summaryOptions.TLSClientKey, "tls-client-key", "", "Path of the client key for mTLS")
+	summaryCmd.PersistentFlags().StringVar(&summaryOptions.TLSServerName, "tls-server-name", "", "Server name to verify the certificate of discovery engine against")
+	summaryCmd.PersistentFlags().DurationVar(&summaryOptions.Timeout, "timeout", summary.DefaultTimeout, "Timeout of each attempt to connect to discovery engine")
+	summaryCmd.PersistentFlags().IntVar(&summaryOptions.Retries, "retries", summary.DefaultRetries, "Attempts to connect to discovery engine after the first one failed")
+
+	summaryCmd.Flags().StringVarP(&summaryOptions.Output, "output", "o", summary.OutputTable, "Output format: "+strings.Join(summary.Outputs, "|"))
+	summaryCmd.Flags().StringVar(&summaryOptions.OutputDir, "output-dir", "", "Directory to write one CSV file per table type to, with -o csv")
+	summaryCmd.Flags().StringVar(&summaryOptions.SortBy, "sort-by", "", "Sort the entries by decreasing "+summary.SortByCount+" or "+summary.SortByTime)
+	summaryCmd.Flags().IntVar(&summaryOptions.Top, "top", 0, "Show the first N entries of each table, the most frequent unless --sort-by is given")
+	summaryCmd.Flags().StringSliceVar(&summaryOptions.Columns, "columns", nil, "Columns of the tables, e.g. SOURCE,DESTINATION,STATUS")
+	summaryCmd.Flags().BoolVar(&summaryOptions.Wrap, "wrap", false, "Wrap the cells wider than their column instead of truncating them")
+	summaryCmd.Flags().IntVar(&summaryOptions.MaxWidth, "max-width", 0, "Maximum width of the tables, the terminal width if 0, unlimited if negative")
+	summaryCmd.Flags().StringVar(&summaryOptions.TimeFormat, "time-format", summary.DefaultTimeFormat, "Go layout of the last updated times")
+	summaryCmd.Flags().StringVar(&summaryOptions.Save, "save", "", "Save the summaries of every pod and entry to a snapshot file")
+	summaryCmd.Flags().BoolVarP(&summaryOptions.Watch, "watch", "w", false, "Refresh the summaries periodically, highlighting new and changed rows")
+	summaryCmd.Flags().DurationVar(&summaryOptions.Interval, "interval", summary.DefaultInterval, "Refresh interval of --watch")
+
+	summaryDiffCmd.Flags().StringVarP(&summaryDiffOutput, "output", "o", summary.OutputTable, "Output format: "+strings.Join(summary.DiffOutputs, "|"))
 }
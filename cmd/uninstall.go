@@ -1,69 +1,80 @@
 package cmd
 
 import (
-	"context"
+	"errors"
 	"os"
+	"time"
 
-	di "github.com/accuknox/accuknox-cli/install"
+	"github.com/accuknox/accuknox-cli/uninstall"
 	"github.com/cilium/cilium-cli/defaults"
-	"github.com/cilium/cilium-cli/hubble"
-	ci "github.com/cilium/cilium-cli/install"
-	"github.com/rs/zerolog/log"
-
-	ki "github.com/kubearmor/kubearmor-client/install"
 	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+	"golang.org/x/term"
 )
 
 var (
-	uninstallOptions ki.Options
-	uparams          = ci.UninstallParameters{Writer: os.Stdout}
+	uninstallOptions = uninstall.Options{In: os.Stdin, Out: os.Stdout}
+	uninstallDisable []string
+	uninstallOnly    []string
+	uninstallNs      string
 )
 
 // uninstallCmd represents the get command
 var uninstallCmd = &cobra.Command{
 	Use:   "uninstall",
 	Short: "Uninstall KubeArmor, Cilium and Discovery-engine from a Kubernetes Cluster",
-	Long:  `Uninstall KubeArmor, Cilium and Discovery-engine from a Kubernetes Clusters`,
-	RunE: func(cmd *cobra.Command, args []string) error {
+	Long: `Uninstall KubeArmor, Cilium and Discovery-engine from a Kubernetes Clusters
 
-		// Uninstall Discovery-engine
-		diOptions.Namespace = "explorer"
-		if err := di.DiscoveryEngineUninstaller(client, diOptions); err != nil {
+The namespaces of the components are detected from the labels of their workloads unless given with --namespace and --discovery-engine-namespace.
+The resources to be deleted are listed and confirmation is asked before anything is removed.
+With --purge the policies generated by Discovery-engine, the CRDs and the Discovery-engine namespace are removed as well.
+An inventory of what was removed and what was left in place is printed at the end.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(uninstallDisable) > 0 && len(uninstallOnly) > 0 {
+			return errors.New("--disable and --only can not be used together")
+		}
+		if err := validateDisableFlagInput(uninstallDisable); err != nil {
 			return err
 		}
-
-		// Uninstall KubeArmor
-		if err := ki.K8sUninstaller(client, uninstallOptions); err != nil {
+		if err := validateDisableFlagInput(uninstallOnly); err != nil {
 			return err
 		}
 
-		// Uninstall Cilium
-		uparams.Namespace = namespace
-
-		h := hubble.NewK8sHubble(k8sClient, hubble.Parameters{
-			Namespace:            uparams.Namespace,
-			HelmValuesSecretName: uparams.HelmValuesSecretName,
-			RedactHelmCertKeys:   uparams.RedactHelmCertKeys,
-			Writer:               uparams.Writer,
-		})
-		if err := h.Disable(context.Background()); err != nil {
-			return err
+		uninstallOptions.Components = uninstallOnly
+		if len(uninstallDisable) > 0 {
+			uninstallOptions.Components = nil
+			for _, c := range uninstall.Components {
+				if !slices.Contains(uninstallDisable, c) {
+					uninstallOptions.Components = append(uninstallOptions.Components, c)
+				}
+			}
+			if len(uninstallOptions.Components) == 0 {
+				return errors.New("every component is disabled, nothing to uninstall")
+			}
 		}
-		uninstaller := ci.NewK8sUninstaller(k8sClient, uparams)
-		if err := uninstaller.Uninstall(context.Background()); err != nil {
-			log.Error().Msgf("Unable to uninstall Cilium: %s", err.Error())
+
+		if uninstallNs != "" {
+			uninstallOptions.CiliumNamespace = uninstallNs
+			uninstallOptions.KubeArmorNamespace = uninstallNs
 		}
+		uninstallOptions.Interactive = term.IsTerminal(int(os.Stdin.Fd()))
 
-		return nil
+		return uninstall.Run(client, k8sClient, uninstallOptions)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(uninstallCmd)
 
-	uninstallCmd.Flags().StringVarP(&uninstallOptions.Namespace, "namespace", "n", "kube-system", "Namespace for resources")
-	uninstallCmd.Flags().StringVar(&uparams.HelmValuesSecretName, "helm-values-secret-name", defaults.HelmValuesSecretName, "Secret name to store the auto-generated helm values file. The namespace is the same as where Cilium will be installed")
-	uninstallCmd.Flags().BoolVar(&uparams.RedactHelmCertKeys, "redact-helm-certificate-keys", true, "Do not print in the terminal any certificate keys generated by helm. (Certificates will always be stored unredacted in the secret defined by 'helm-values-secret-name')")
-	uninstallCmd.Flags().StringVar(&uparams.TestNamespace, "test-namespace", defaults.ConnectivityCheckNamespace, "Namespace to uninstall Cilium tests from")
-	uninstallCmd.Flags().BoolVar(&uparams.Wait, "wait", false, "Wait for uninstallation to have completed")
+	uninstallCmd.Flags().StringSliceVarP(&uninstallDisable, "disable", "d", []string{}, "disable uninstalling a program { cilium | kubearmor | discoveryengine }")
+	uninstallCmd.Flags().StringSliceVar(&uninstallOnly, "only", []string{}, "only uninstall these programs { cilium | kubearmor | discoveryengine }")
+	uninstallCmd.Flags().StringVarP(&uninstallNs, "namespace", "n", "", "Namespace of Cilium and KubeArmor (detected if not set)")
+	uninstallCmd.Flags().StringVar(&uninstallOptions.DiscoveryEngineNamespace, "discovery-engine-namespace", "", "Namespace of Discovery-engine (detected if not set)")
+	uninstallCmd.Flags().BoolVarP(&uninstallOptions.Yes, "yes", "y", false, "Do not ask for confirmation")
+	uninstallCmd.Flags().StringVar(&uninstallOptions.HelmValuesSecretName, "helm-values-secret-name", defaults.HelmValuesSecretName, "Secret name to store the auto-generated helm values file. The namespace is the same as where Cilium will be installed")
+	uninstallCmd.Flags().BoolVar(&uninstallOptions.RedactHelmCertKeys, "redact-helm-certificate-keys", true, "Do not print in the terminal any certificate keys generated by helm. (Certificates will always be stored unredacted in the secret defined by 'helm-values-secret-name')")
+	uninstallCmd.Flags().StringVar(&uninstallOptions.TestNamespace, "test-namespace", defaults.ConnectivityCheckNamespace, "Namespace to uninstall Cilium tests from")
+	uninstallCmd.Flags().BoolVar(&uninstallOptions.Wait, "wait", false, "Wait for uninstallation to have completed")
+	uninstallCmd.Flags().BoolVar(&uninstallOptions.Purge, "purge", false, "Also remove the policies generated by Discovery-engine, the Cilium CRDs and the Discovery-engine namespace")
+	uninstallCmd.Flags().DurationVar(&uninstallOptions.PurgeTimeout, "purge-timeout", 5*time.Minute, "Maximum time to wait for purged resources to be deleted")
 }
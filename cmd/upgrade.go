@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/accuknox/accuknox-cli/upgrade"
+	"github.com/cilium/cilium-cli/defaults"
+	"github.com/spf13/cobra"
+)
+
+var upgradeOptions = upgrade.Options{Writer: os.Stdout}
+
+// upgradeCmd represents the upgrade command
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrade KubeArmor, Cilium and Discovery-engine in a Kubernetes Cluster",
+	Long: `Detect the installed versions of Cilium, KubeArmor and Discovery-engine, show the upgrade plan and roll each component forward in turn.
+hubble-relay, which the Cilium upgrade leaves on its version, is rolled to the Cilium version after Cilium.
+A component that does not become ready is rolled back and the upgrade stops.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateDisableFlagInput(upgradeOptions.Disable); err != nil {
+			return err
+		}
+		return upgrade.Run(client, k8sClient, upgradeOptions)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(upgradeCmd)
+
+	upgradeCmd.Flags().StringSliceVarP(&upgradeOptions.Disable, "disable", "d", []string{}, "disable upgrading a program { cilium | kubearmor | discoveryengine }")
+	upgradeCmd.Flags().StringVarP(&upgradeOptions.Namespace, "namespace", "n", "kube-system", "Namespace of Cilium and KubeArmor")
+	upgradeCmd.Flags().StringVar(&upgradeOptions.DiscoveryEngineNamespace, "discovery-engine-namespace", "explorer", "Namespace of Discovery-engine")
+	upgradeCmd.Flags().StringVar(&upgradeOptions.CiliumVersion, "version", defaults.Version, "Cilium version to upgrade to")
+	upgradeCmd.Flags().StringVarP(&upgradeOptions.KubeArmorImage, "image", "i", "kubearmor/kubearmor:stable", "Kubearmor daemonset image to upgrade to")
+	upgradeCmd.Flags().StringVar(&upgradeOptions.DiscoveryEngineImage, "discovery-engine-image", "accuknox/knoxautopolicy:stable", "Discovery-engine image to upgrade to")
+	upgradeCmd.Flags().StringVar(&upgradeOptions.HelmValuesSecretName, "helm-values-secret-name", defaults.HelmValuesSecretName, "Secret name holding the helm values file Cilium was installed with")
+	upgradeCmd.Flags().DurationVar(&upgradeOptions.WaitDuration, "wait-duration", 5*time.Minute, "Maximum time to wait for each component to become ready")
+	upgradeCmd.Flags().BoolVar(&upgradeOptions.PlanOnly, "plan", false, "Only show the upgrade plan, do not modify the cluster")
+	upgradeCmd.Flags().BoolVar(&upgradeOptions.AllowDowngrade, "allow-downgrade", false, "Allow rolling a component back to an older version")
+}
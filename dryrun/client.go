@@ -0,0 +1,289 @@
+package dryrun
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cilium/cilium-cli/k8s"
+	"github.com/cilium/cilium/api/v1/models"
+	ciliumv2 "github.com/cilium/cilium/pkg/k8s/apis/cilium.io/v2"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// recorder stands in for the cilium-cli Kubernetes client. Cluster discovery
+// (flavor, version, nodes) is read from the real cluster, every write is
+// recorded instead of being sent, and reads of namespaced objects are served
+// from what has been recorded so far.
+type recorder struct {
+	*k8s.Client
+
+	writer  io.Writer
+	objects []runtime.Object
+}
+
+func newRecorder(c *k8s.Client, w io.Writer) *recorder {
+	return &recorder{Client: c, writer: w}
+}
+
+func (r *recorder) record(obj runtime.Object) {
+	key := objectKey(obj)
+	for i, o := range r.objects {
+		if objectKey(o) == key {
+			r.objects[i] = obj
+			return
+		}
+	}
+	r.objects = append(r.objects, obj)
+}
+
+func (r *recorder) lookup(kind, namespace, name string) runtime.Object {
+	for _, o := range r.objects {
+		meta, err := metaOf(o)
+		if err != nil {
+			continue
+		}
+		if kindOf(o) == kind && meta.GetNamespace() == namespace && meta.GetName() == name {
+			return o
+		}
+	}
+	return nil
+}
+
+func notFound(resource, name string) error {
+	return k8serrors.NewNotFound(schema.GroupResource{Resource: resource}, name)
+}
+
+func withNamespace(obj metav1.Object, namespace string) {
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace(namespace)
+	}
+}
+
+func (r *recorder) CreateServiceAccount(ctx context.Context, namespace string, account *corev1.ServiceAccount, opts metav1.CreateOptions) (*corev1.ServiceAccount, error) {
+	withNamespace(account, namespace)
+	r.record(account)
+	return account, nil
+}
+
+func (r *recorder) CreateConfigMap(ctx context.Context, namespace string, config *corev1.ConfigMap, opts metav1.CreateOptions) (*corev1.ConfigMap, error) {
+	withNamespace(config, namespace)
+	r.record(config)
+	return config, nil
+}
+
+func (r *recorder) UpdateConfigMap(ctx context.Context, configMap *corev1.ConfigMap, opts metav1.UpdateOptions) (*corev1.ConfigMap, error) {
+	r.record(configMap)
+	return configMap, nil
+}
+
+func (r *recorder) GetConfigMap(ctx context.Context, namespace, name string, opts metav1.GetOptions) (*corev1.ConfigMap, error) {
+	if o, ok := r.lookup("ConfigMap", namespace, name).(*corev1.ConfigMap); ok {
+		return o.DeepCopy(), nil
+	}
+	return nil, notFound("configmaps", name)
+}
+
+func (r *recorder) CreateClusterRole(ctx context.Context, role *rbacv1.ClusterRole, opts metav1.CreateOptions) (*rbacv1.ClusterRole, error) {
+	r.record(role)
+	return role, nil
+}
+
+func (r *recorder) CreateClusterRoleBinding(ctx context.Context, role *rbacv1.ClusterRoleBinding, opts metav1.CreateOptions) (*rbacv1.ClusterRoleBinding, error) {
+	r.record(role)
+	return role, nil
+}
+
+func (r *recorder) CreateDaemonSet(ctx context.Context, namespace string, ds *appsv1.DaemonSet, opts metav1.CreateOptions) (*appsv1.DaemonSet, error) {
+	withNamespace(ds, namespace)
+	r.record(ds)
+	return ds, nil
+}
+
+func (r *recorder) GetDaemonSet(ctx context.Context, namespace, name string, opts metav1.GetOptions) (*appsv1.DaemonSet, error) {
+	if o, ok := r.lookup("DaemonSet", namespace, name).(*appsv1.DaemonSet); ok {
+		return o.DeepCopy(), nil
+	}
+	return nil, notFound("daemonsets", name)
+}
+
+func (r *recorder) PatchDaemonSet(ctx context.Context, namespace, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions) (*appsv1.DaemonSet, error) {
+	fmt.Fprintf(r.writer, "dry-run: skipping patch of DaemonSet %s/%s: %s\n", namespace, name, data)
+	return &appsv1.DaemonSet{}, nil
+}
+
+func (r *recorder) CreateService(ctx context.Context, namespace string, service *corev1.Service, opts metav1.CreateOptions) (*corev1.Service, error) {
+	withNamespace(service, namespace)
+	r.record(service)
+	return service, nil
+}
+
+func (r *recorder) GetService(ctx context.Context, namespace, name string, opts metav1.GetOptions) (*corev1.Service, error) {
+	if o, ok := r.lookup("Service", namespace, name).(*corev1.Service); ok {
+		return o.DeepCopy(), nil
+	}
+	return nil, notFound("services", name)
+}
+
+func (r *recorder) CreateDeployment(ctx context.Context, namespace string, deployment *appsv1.Deployment, opts metav1.CreateOptions) (*appsv1.Deployment, error) {
+	withNamespace(deployment, namespace)
+	r.record(deployment)
+	return deployment, nil
+}
+
+func (r *recorder) GetDeployment(ctx context.Context, namespace, name string, opts metav1.GetOptions) (*appsv1.Deployment, error) {
+	if o, ok := r.lookup("Deployment", namespace, name).(*appsv1.Deployment); ok {
+		return o.DeepCopy(), nil
+	}
+	return nil, notFound("deployments", name)
+}
+
+func (r *recorder) PatchDeployment(ctx context.Context, namespace, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions) (*appsv1.Deployment, error) {
+	fmt.Fprintf(r.writer, "dry-run: skipping patch of Deployment %s/%s: %s\n", namespace, name, data)
+	return &appsv1.Deployment{}, nil
+}
+
+func (r *recorder) CheckDeploymentStatus(ctx context.Context, namespace, deployment string) error {
+	return nil
+}
+
+func (r *recorder) CreateNamespace(ctx context.Context, namespace string, opts metav1.CreateOptions) (*corev1.Namespace, error) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+	r.record(ns)
+	return ns, nil
+}
+
+func (r *recorder) GetNamespace(ctx context.Context, namespace string, options metav1.GetOptions) (*corev1.Namespace, error) {
+	if o, ok := r.lookup("Namespace", "", namespace).(*corev1.Namespace); ok {
+		return o.DeepCopy(), nil
+	}
+	return nil, notFound("namespaces", namespace)
+}
+
+func (r *recorder) CreateSecret(ctx context.Context, namespace string, secret *corev1.Secret, opts metav1.CreateOptions) (*corev1.Secret, error) {
+	withNamespace(secret, namespace)
+	r.record(secret)
+	return secret, nil
+}
+
+func (r *recorder) UpdateSecret(ctx context.Context, namespace string, secret *corev1.Secret, opts metav1.UpdateOptions) (*corev1.Secret, error) {
+	withNamespace(secret, namespace)
+	r.record(secret)
+	return secret, nil
+}
+
+func (r *recorder) GetSecret(ctx context.Context, namespace, name string, opts metav1.GetOptions) (*corev1.Secret, error) {
+	if o, ok := r.lookup("Secret", namespace, name).(*corev1.Secret); ok {
+		return o.DeepCopy(), nil
+	}
+	return nil, notFound("secrets", name)
+}
+
+func (r *recorder) PatchSecret(ctx context.Context, namespace, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions) (*corev1.Secret, error) {
+	fmt.Fprintf(r.writer, "dry-run: skipping patch of Secret %s/%s\n", namespace, name)
+	return &corev1.Secret{}, nil
+}
+
+func (r *recorder) CreateResourceQuota(ctx context.Context, namespace string, rq *corev1.ResourceQuota, opts metav1.CreateOptions) (*corev1.ResourceQuota, error) {
+	withNamespace(rq, namespace)
+	r.record(rq)
+	return rq, nil
+}
+
+func (r *recorder) CreateIngressClass(ctx context.Context, ingressClass *networkingv1.IngressClass, opts metav1.CreateOptions) (*networkingv1.IngressClass, error) {
+	r.record(ingressClass)
+	return ingressClass, nil
+}
+
+func (r *recorder) CreateCiliumExternalWorkload(ctx context.Context, cew *ciliumv2.CiliumExternalWorkload, opts metav1.CreateOptions) (*ciliumv2.CiliumExternalWorkload, error) {
+	return nil, errors.New("dry-run: external workloads are not supported")
+}
+
+// Nothing is running in a dry-run, so there are no pods or endpoints to
+// inspect and nothing to delete.
+
+func (r *recorder) ListPods(ctx context.Context, namespace string, options metav1.ListOptions) (*corev1.PodList, error) {
+	return &corev1.PodList{}, nil
+}
+
+func (r *recorder) ListCiliumEndpoints(ctx context.Context, namespace string, options metav1.ListOptions) (*ciliumv2.CiliumEndpointList, error) {
+	return &ciliumv2.CiliumEndpointList{}, nil
+}
+
+func (r *recorder) CiliumStatus(ctx context.Context, namespace, pod string) (*models.StatusResponse, error) {
+	return nil, errors.New("dry-run: cilium is not running")
+}
+
+func (r *recorder) GetRunningCiliumVersion(ctx context.Context, namespace string) (string, error) {
+	return "", errors.New("dry-run: cilium is not running")
+}
+
+func (r *recorder) ExecInPod(ctx context.Context, namespace, pod, container string, command []string) (bytes.Buffer, error) {
+	return bytes.Buffer{}, nil
+}
+
+func (r *recorder) DeletePod(ctx context.Context, namespace, name string, opts metav1.DeleteOptions) error {
+	return nil
+}
+
+func (r *recorder) DeletePodCollection(ctx context.Context, namespace string, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error {
+	return nil
+}
+
+func (r *recorder) DeleteServiceAccount(ctx context.Context, namespace, name string, opts metav1.DeleteOptions) error {
+	return nil
+}
+
+func (r *recorder) DeleteConfigMap(ctx context.Context, namespace, name string, opts metav1.DeleteOptions) error {
+	return nil
+}
+
+func (r *recorder) DeleteClusterRole(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return nil
+}
+
+func (r *recorder) DeleteClusterRoleBinding(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return nil
+}
+
+func (r *recorder) DeleteDaemonSet(ctx context.Context, namespace, name string, opts metav1.DeleteOptions) error {
+	return nil
+}
+
+func (r *recorder) DeleteService(ctx context.Context, namespace, name string, opts metav1.DeleteOptions) error {
+	return nil
+}
+
+func (r *recorder) DeleteDeployment(ctx context.Context, namespace, name string, opts metav1.DeleteOptions) error {
+	return nil
+}
+
+func (r *recorder) DeleteNamespace(ctx context.Context, namespace string, opts metav1.DeleteOptions) error {
+	return nil
+}
+
+func (r *recorder) DeleteSecret(ctx context.Context, namespace, name string, opts metav1.DeleteOptions) error {
+	return nil
+}
+
+func (r *recorder) DeleteResourceQuota(ctx context.Context, namespace, name string, opts metav1.DeleteOptions) error {
+	return nil
+}
+
+func (r *recorder) DeleteIngressClass(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return nil
+}
+
+func (r *recorder) DeleteCiliumExternalWorkload(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return nil
+}
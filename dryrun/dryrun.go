@@ -0,0 +1,281 @@
+package dryrun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	di "github.com/accuknox/accuknox-cli/install"
+	"github.com/cilium/cilium-cli/hubble"
+	ci "github.com/cilium/cilium-cli/install"
+	ciliumk8s "github.com/cilium/cilium-cli/k8s"
+	ki "github.com/kubearmor/kubearmor-client/install"
+	"github.com/kubearmor/kubearmor-client/k8s"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	extfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
+)
+
+// Manifest holds every object a component install would create
+type Manifest struct {
+	Component string
+	Objects   []runtime.Object
+}
+
+var scheme = runtime.NewScheme()
+
+// kindOrder lists kinds in the order they have to be applied
+var kindOrder = []string{
+	"Namespace",
+	"CustomResourceDefinition",
+	"ServiceAccount",
+	"Secret",
+	"ConfigMap",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"Role",
+	"RoleBinding",
+	"ResourceQuota",
+	"IngressClass",
+	"Service",
+	"DaemonSet",
+	"Deployment",
+	"MutatingWebhookConfiguration",
+}
+
+// clusterScoped lists kinds whose namespace must not be rendered
+var clusterScoped = map[string]bool{
+	"Namespace":                    true,
+	"CustomResourceDefinition":     true,
+	"ClusterRole":                  true,
+	"ClusterRoleBinding":           true,
+	"IngressClass":                 true,
+	"MutatingWebhookConfiguration": true,
+}
+
+func init() {
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = apiextensionsv1.AddToScheme(scheme)
+}
+
+func kindOf(obj runtime.Object) string {
+	if gvks, _, err := scheme.ObjectKinds(obj); err == nil && len(gvks) > 0 {
+		return gvks[0].Kind
+	}
+	return reflect.TypeOf(obj).Elem().Name()
+}
+
+func metaOf(obj runtime.Object) (metav1.Object, error) {
+	return meta.Accessor(obj)
+}
+
+func objectKey(obj runtime.Object) string {
+	m, err := metaOf(obj)
+	if err != nil {
+		return kindOf(obj)
+	}
+	return kindOf(obj) + "/" + m.GetNamespace() + "/" + m.GetName()
+}
+
+func kindRank(kind string) int {
+	for i, k := range kindOrder {
+		if k == kind {
+			return i
+		}
+	}
+	return len(kindOrder)
+}
+
+func sortObjects(objects []runtime.Object) {
+	sort.SliceStable(objects, func(i, j int) bool {
+		return kindRank(kindOf(objects[i])) < kindRank(kindOf(objects[j]))
+	})
+}
+
+// Cilium runs the Cilium installer and enables Hubble against a recording
+// client. Installer progress is written to w.
+func Cilium(c *ciliumk8s.Client, p ci.Parameters, hp hubble.Parameters, w io.Writer) (*Manifest, error) {
+	r := newRecorder(c, w)
+
+	p.Writer = w
+	p.Wait = false
+	p.RestartUnmanagedPods = false
+	installer, err := ci.NewK8sInstaller(r, p)
+	if err != nil {
+		return nil, err
+	}
+	if err := installer.Install(context.Background()); err != nil {
+		return nil, fmt.Errorf("unable to render Cilium: %w", err)
+	}
+
+	hp.Writer = w
+	hp.Wait = false
+	if err := hubble.NewK8sHubble(r, hp).Enable(context.Background()); err != nil {
+		return nil, fmt.Errorf("unable to render Hubble: %w", err)
+	}
+
+	sortObjects(r.objects)
+	return &Manifest{Component: "cilium", Objects: r.objects}, nil
+}
+
+// KubeArmor runs the KubeArmor installer against a fake clientset seeded with
+// the cluster nodes. Installer progress is written to w.
+func KubeArmor(c *k8s.Client, o ki.Options, w io.Writer) (*Manifest, error) {
+	nodes, err := c.K8sClientset.CoreV1().Nodes().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	seed := make([]runtime.Object, 0, len(nodes.Items))
+	for i := range nodes.Items {
+		seed = append(seed, &nodes.Items[i])
+	}
+
+	clientset := fake.NewSimpleClientset(seed...)
+	extClientset := extfake.NewSimpleClientset()
+	fc := &k8s.Client{
+		K8sClientset:    clientset,
+		APIextClientset: extClientset,
+		RawConfig:       c.RawConfig,
+		Config:          c.Config,
+	}
+
+	// the KubeArmor installer prints its progress to stdout
+	stdout := os.Stdout
+	if f, ok := w.(*os.File); ok {
+		os.Stdout = f
+	}
+	err = ki.K8sInstaller(fc, o)
+	os.Stdout = stdout
+	if err != nil {
+		return nil, fmt.Errorf("unable to render KubeArmor: %w", err)
+	}
+
+	var objects []runtime.Object
+	for _, actions := range [][]k8stesting.Action{extClientset.Actions(), clientset.Actions()} {
+		for _, action := range actions {
+			if create, ok := action.(k8stesting.CreateAction); ok {
+				obj := create.GetObject()
+				if m, err := metaOf(obj); err == nil {
+					withNamespace(m, action.GetNamespace())
+				}
+				objects = append(objects, obj)
+			}
+		}
+	}
+
+	sortObjects(objects)
+	return &Manifest{Component: "kubearmor", Objects: objects}, nil
+}
+
+// DiscoveryEngine collects the discovery-engine objects
+func DiscoveryEngine(o di.Options) (*Manifest, error) {
+	objects, err := di.DiscoveryEngineObjects(o)
+	if err != nil {
+		return nil, fmt.Errorf("unable to render Discovery-engine: %w", err)
+	}
+	sortObjects(objects)
+	return &Manifest{Component: "discovery-engine", Objects: objects}, nil
+}
+
+// Write renders the manifests as a multi-document YAML stream to w, or as one
+// file per component if dir is set
+func Write(manifests []*Manifest, output, dir string, w io.Writer) error {
+	if output != "yaml" {
+		return fmt.Errorf("invalid output format %q, {yaml}", output)
+	}
+
+	if dir == "" {
+		for _, m := range manifests {
+			if err := writeManifest(m, w); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	for _, m := range manifests {
+		path := filepath.Join(dir, m.Component+".yaml")
+		f, err := os.Create(filepath.Clean(path))
+		if err != nil {
+			return err
+		}
+		err = writeManifest(m, f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", path)
+	}
+	return nil
+}
+
+func writeManifest(m *Manifest, w io.Writer) error {
+	for _, obj := range m.Objects {
+		doc, err := toYAML(obj)
+		if err != nil {
+			return fmt.Errorf("%s: %w", m.Component, err)
+		}
+		if _, err := fmt.Fprintf(w, "---\n# component: %s\n%s", m.Component, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func toYAML(obj runtime.Object) ([]byte, error) {
+	gvks, _, err := scheme.ObjectKinds(obj)
+	if err != nil {
+		return nil, err
+	}
+	if len(gvks) == 0 {
+		return nil, errors.New("unknown object kind")
+	}
+	obj = obj.DeepCopyObject()
+	obj.GetObjectKind().SetGroupVersionKind(gvks[0])
+
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	delete(u, "status")
+	if md, ok := u["metadata"].(map[string]interface{}); ok {
+		delete(md, "creationTimestamp")
+		if clusterScoped[gvks[0].Kind] {
+			delete(md, "namespace")
+		}
+	}
+	dropNullTimestamps(u)
+
+	return yaml.Marshal(u)
+}
+
+// dropNullTimestamps drops the null creationTimestamp fields nested in pod templates
+func dropNullTimestamps(m map[string]interface{}) {
+	for k, v := range m {
+		switch val := v.(type) {
+		case nil:
+			if strings.EqualFold(k, "creationTimestamp") {
+				delete(m, k)
+			}
+		case map[string]interface{}:
+			dropNullTimestamps(val)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package grpcutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// TLS configures the TLS connection to a gRPC server. The CA and the client
+// certificate are read from the files when given, or else taken from the PEM
+// data.
+type TLS struct {
+	Enabled    bool
+	ServerName string
+
+	CACertFile     string
+	ClientCertFile string
+	ClientKeyFile  string
+
+	CACert     []byte
+	ClientCert []byte
+	ClientKey  []byte
+}
+
+// Credentials returns the credentials of the connection, with a client
+// certificate for mTLS when one is given
+func Credentials(t TLS) (grpc.DialOption, error) {
+	if !t.Enabled {
+		return grpc.WithInsecure(), nil
+	}
+
+	config := &tls.Config{
+		ServerName: t.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	ca := t.CACert
+	if t.CACertFile != "" {
+		b, err := os.ReadFile(t.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the CA certificate: %w", err)
+		}
+		ca = b
+	}
+	if len(ca) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("no valid certificate found in the CA certificate")
+		}
+		config.RootCAs = pool
+	}
+
+	cert, key := t.ClientCert, t.ClientKey
+	if t.ClientCertFile != "" || t.ClientKeyFile != "" {
+		if t.ClientCertFile == "" || t.ClientKeyFile == "" {
+			return nil, errors.New("--tls-client-cert and --tls-client-key must be given together")
+		}
+		var err error
+		if cert, err = os.ReadFile(t.ClientCertFile); err != nil {
+			return nil, fmt.Errorf("unable to read the client certificate: %w", err)
+		}
+		if key, err = os.ReadFile(t.ClientKeyFile); err != nil {
+			return nil, fmt.Errorf("unable to read the client key: %w", err)
+		}
+	}
+	if len(cert) > 0 && len(key) > 0 {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+
+	return grpc.WithTransportCredentials(handshakeCredentials{credentials.NewTLS(config)}), nil
+}
+
+// TimeoutError is returned when the connection is not ready within the
+// timeout. Err is the last connection error.
+type TimeoutError struct {
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s: %v", e.Timeout, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Dial connects to addr, waiting up to timeout for the connection to be
+// ready. It fails right away when the server refuses the connection or the
+// TLS handshake fails, and returns a TimeoutError with the last connection
+// error otherwise.
+func Dial(addr string, creds grpc.DialOption, timeout time.Duration) (*grpc.ClientConn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, addr, creds, grpc.WithBlock(),
+		grpc.WithReturnConnectionError(), grpc.FailOnNonTempDialError(true))
+	if err != nil && ctx.Err() != nil {
+		return nil, &TimeoutError{Timeout: timeout, Err: err}
+	}
+	return conn, err
+}
+
+// IsHandshakeError reports whether the connection failed because of the TLS
+// handshake, which trying again does not fix
+func IsHandshakeError(err error) bool {
+	var herr *handshakeError
+	return errors.As(err, &herr)
+}
+
+// handshakeError is a failed TLS handshake. It is not temporary, so that the
+// dial fails right away instead of trying again until the timeout.
+type handshakeError struct {
+	err error
+}
+
+func (e *handshakeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *handshakeError) Unwrap() error {
+	return e.err
+}
+
+func (e *handshakeError) Temporary() bool {
+	return false
+}
+
+// handshakeCredentials wraps the TLS handshake failures other than timeouts in
+// handshakeError
+type handshakeCredentials struct {
+	credentials.TransportCredentials
+}
+
+func (c handshakeCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	tlsConn, info, err := c.TransportCredentials.ClientHandshake(ctx, authority, conn)
+	var ne net.Error
+	if err != nil && !(errors.As(err, &ne) && ne.Timeout()) {
+		return nil, nil, &handshakeError{err}
+	}
+	return tlsConn, info, err
+}
+
+func (c handshakeCredentials) Clone() credentials.TransportCredentials {
+	return handshakeCredentials{c.TransportCredentials.Clone()}
+}
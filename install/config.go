@@ -0,0 +1,262 @@
+package install
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+)
+
+// Config -- discovery-engine configuration stored in the knoxautopolicy-config ConfigMap
+type Config struct {
+	Application   ApplicationConfig  `json:"application"`
+	Observability bool               `json:"observability"`
+	Database      DatabaseConfig     `json:"database"`
+	FeedConsumer  FeedConsumerConfig `json:"feed-consumer"`
+	Logging       LoggingConfig      `json:"logging"`
+	CiliumHubble  EndpointConfig     `json:"cilium-hubble"`
+	KubeArmor     EndpointConfig     `json:"kubearmor"`
+}
+
+// ApplicationConfig -- policy discovery settings
+type ApplicationConfig struct {
+	Name    string        `json:"name"`
+	Network NetworkConfig `json:"network"`
+	System  SystemConfig  `json:"system"`
+	Cluster ClusterConfig `json:"cluster"`
+}
+
+// NetworkConfig -- network policy discovery settings
+type NetworkConfig struct {
+	OperationMode          int    `json:"operation-mode"`         // 1: cronjob | 2: one-time-job
+	CronJobTimeInterval    string `json:"cron-job-time-interval"` // format: XhYmZs
+	OperationTrigger       int    `json:"operation-trigger"`
+	NetworkLogFrom         string `json:"network-log-from"` // db|hubble
+	NetworkLogFile         string `json:"network-log-file"`
+	NetworkPolicyTo        string `json:"network-policy-to"` // db|file
+	NetworkPolicyDir       string `json:"network-policy-dir"`
+	NetworkPolicyTypes     int    `json:"network-policy-types"`
+	NetworkPolicyRuleTypes int    `json:"network-policy-rule-types"`
+}
+
+// SystemConfig -- system policy discovery settings
+type SystemConfig struct {
+	OperationMode       int    `json:"operation-mode"`         // 1: cronjob | 2: one-time-job
+	CronJobTimeInterval string `json:"cron-job-time-interval"` // format: XhYmZs
+	SystemLogFrom       string `json:"system-log-from"`        // db|kubearmor
+	SystemLogFile       string `json:"system-log-file"`
+	SystemPolicyTo      string `json:"system-policy-to"` // db|file
+	SystemPolicyDir     string `json:"system-policy-dir"`
+	DeprecateOldMode    bool   `json:"deprecate-old-mode"`
+}
+
+// ClusterConfig -- where cluster information is read from
+type ClusterConfig struct {
+	ClusterInfoFrom string `json:"cluster-info-from"` // k8sclient|accuknox
+}
+
+// DatabaseConfig -- policy and log storage, the connection settings are only
+// used by the mysql driver
+type DatabaseConfig struct {
+	Driver             string `json:"driver"`
+	Host               string `json:"host,omitempty"`
+	Port               int    `json:"port,omitempty"`
+	User               string `json:"user,omitempty"`
+	Password           string `json:"password,omitempty"`
+	DBName             string `json:"dbname"`
+	TableConfiguration string `json:"table-configuration"`
+	TableNetworkLog    string `json:"table-network-log"`
+	TableNetworkPolicy string `json:"table-network-policy"`
+	TableSystemLog     string `json:"table-system-log"`
+	TableSystemPolicy  string `json:"table-system-policy"`
+}
+
+// FeedConsumerConfig -- feed consumer settings
+type FeedConsumerConfig struct {
+	Kafka KafkaConfig `json:"kafka"`
+}
+
+// KafkaConfig -- kafka consumer settings
+type KafkaConfig struct {
+	BrokerAddressFamily string      `json:"broker-address-family"`
+	SessionTimeoutMs    int         `json:"session-timeout-ms"`
+	AutoOffsetReset     string      `json:"auto-offset-reset"`
+	BootstrapServers    string      `json:"bootstrap-servers"`
+	GroupID             string      `json:"group-id"`
+	Topics              []string    `json:"topics"`
+	SSL                 KafkaSSL    `json:"ssl"`
+	Events              KafkaEvents `json:"events"`
+}
+
+// KafkaSSL -- kafka TLS settings
+type KafkaSSL struct {
+	Enabled bool `json:"enabled"`
+}
+
+// KafkaEvents -- kafka event settings
+type KafkaEvents struct {
+	Buffer int `json:"buffer"`
+}
+
+// LoggingConfig -- logging settings
+type LoggingConfig struct {
+	Level string `json:"level"`
+}
+
+// EndpointConfig -- address of a service discovery-engine reads logs from
+type EndpointConfig struct {
+	URL  string `json:"url"`
+	Port int    `json:"port"`
+}
+
+var (
+	operationModes = []int{1, 2}
+	logLevels      = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+)
+
+// DefaultConfig -- default discovery-engine configuration, the hubble and
+// kubearmor URLs are left empty to follow the namespaces of the install
+func DefaultConfig() Config {
+	return Config{
+		Application: ApplicationConfig{
+			Name: "knoxautopolicy",
+			Network: NetworkConfig{
+				OperationMode:          1,
+				CronJobTimeInterval:    "0h0m10s",
+				OperationTrigger:       1000,
+				NetworkLogFrom:         "hubble",
+				NetworkLogFile:         "./flow.json",
+				NetworkPolicyTo:        "db",
+				NetworkPolicyDir:       "./",
+				NetworkPolicyTypes:     3,
+				NetworkPolicyRuleTypes: 511,
+			},
+			System: SystemConfig{
+				OperationMode:       1,
+				CronJobTimeInterval: "0h0m10s",
+				SystemLogFrom:       "kubearmor",
+				SystemLogFile:       "./log.json",
+				SystemPolicyTo:      "db",
+				SystemPolicyDir:     "./",
+				DeprecateOldMode:    true,
+			},
+			Cluster: ClusterConfig{
+				ClusterInfoFrom: "k8sclient",
+			},
+		},
+		Database: DatabaseConfig{
+			Driver:             "sqlite3",
+			DBName:             "knoxautopolicy",
+			TableConfiguration: "auto_policy_config",
+			TableNetworkLog:    "network_log",
+			TableNetworkPolicy: "network_policy",
+			TableSystemLog:     "system_log",
+			TableSystemPolicy:  "system_policy",
+		},
+		FeedConsumer: FeedConsumerConfig{
+			Kafka: KafkaConfig{
+				BrokerAddressFamily: "v4",
+				SessionTimeoutMs:    6000,
+				AutoOffsetReset:     "earliest",
+				BootstrapServers:    "dev-kafka-kafka-bootstrap.accuknox-dev-kafka.svc.cluster.local:9092",
+				GroupID:             "policy.cilium",
+				Topics:              []string{"cilium-telemetry-new", "kubearmor-syslogs"},
+				Events:              KafkaEvents{Buffer: 50},
+			},
+		},
+		Logging: LoggingConfig{
+			Level: "INFO",
+		},
+		CiliumHubble: EndpointConfig{
+			Port: 80,
+		},
+		KubeArmor: EndpointConfig{
+			Port: 32767,
+		},
+	}
+}
+
+// SetEndpoints -- point unset hubble and kubearmor URLs to the services in the
+// namespaces Cilium and KubeArmor are installed in
+func (c *Config) SetEndpoints(ciliumNamespace, kubearmorNamespace string) {
+	if c.CiliumHubble.URL == "" {
+		c.CiliumHubble.URL = fmt.Sprintf("hubble-relay.%s.svc.cluster.local", ciliumNamespace)
+	}
+	if c.KubeArmor.URL == "" {
+		c.KubeArmor.URL = fmt.Sprintf("kubearmor.%s.svc.cluster.local", kubearmorNamespace)
+	}
+}
+
+// LoadConfig -- decode a YAML or JSON document onto c, keeping the values of
+// fields it does not set
+func LoadConfig(b []byte, c *Config) error {
+	return yaml.UnmarshalStrict(b, c)
+}
+
+// LoadConfigFile -- decode a YAML or JSON values file onto c
+func LoadConfigFile(path string, c *Config) error {
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	if err := LoadConfig(b, c); err != nil {
+		return fmt.Errorf("invalid discovery-engine values file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate -- check the configuration, errors are reported relative to path
+func (c *Config) Validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	network := path.Child("application", "network")
+	system := path.Child("application", "system")
+
+	if !slices.Contains(operationModes, c.Application.Network.OperationMode) {
+		errs = append(errs, field.NotSupported(network.Child("operation-mode"), c.Application.Network.OperationMode, []string{"1", "2"}))
+	}
+	if !slices.Contains(operationModes, c.Application.System.OperationMode) {
+		errs = append(errs, field.NotSupported(system.Child("operation-mode"), c.Application.System.OperationMode, []string{"1", "2"}))
+	}
+	errs = append(errs, validateInterval(c.Application.Network.CronJobTimeInterval, network.Child("cron-job-time-interval"))...)
+	errs = append(errs, validateInterval(c.Application.System.CronJobTimeInterval, system.Child("cron-job-time-interval"))...)
+
+	if !slices.Contains(logLevels, strings.ToUpper(c.Logging.Level)) {
+		errs = append(errs, field.NotSupported(path.Child("logging", "level"), c.Logging.Level, logLevels))
+	}
+
+	errs = append(errs, validatePort(c.CiliumHubble.Port, path.Child("cilium-hubble", "port"))...)
+	errs = append(errs, validatePort(c.KubeArmor.Port, path.Child("kubearmor", "port"))...)
+
+	return errs
+}
+
+func validateInterval(interval string, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if d, err := time.ParseDuration(interval); err != nil || d <= 0 {
+		errs = append(errs, field.Invalid(path, interval, "must be a positive interval in the format XhYmZs"))
+	}
+	return errs
+}
+
+func validatePort(port int, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if port < 1 || port > 65535 {
+		errs = append(errs, field.Invalid(path, port, "must be between 1 and 65535"))
+	}
+	return errs
+}
+
+// Render -- the conf.yaml stored in the ConfigMap
+func (c *Config) Render() (string, error) {
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -6,9 +6,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
-	"path"
 	"path/filepath"
-	"reflect"
 	"strings"
 	"sync"
 	"time"
@@ -21,9 +19,9 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
@@ -41,9 +39,29 @@ import (
 
 // Options -- options
 type Options struct {
-	Namespace string
+	Namespace   string
+	Image       string
+	Config      *Config
+	NoOverwrite bool
 }
 
+// setDefaults -- fill unset options with the default namespace, image and config
+func (o *Options) setDefaults() {
+	if o.Namespace == "" {
+		o.Namespace = namespace
+	}
+	if o.Image == "" {
+		o.Image = defaultImage
+	}
+	if o.Config == nil {
+		c := DefaultConfig()
+		o.Config = &c
+	}
+	o.Config.SetEndpoints("kube-system", "kube-system")
+}
+
+const defaultImage = "accuknox/knoxautopolicy:stable"
+
 var selectorLabels = map[string]string{
 	"container": "knoxautopolicy",
 }
@@ -64,8 +82,9 @@ func GetService(namespace string) *corev1.Service {
 			APIVersion: "v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   "knoxautopolicy",
-			Labels: serviceLabels,
+			Name:      "knoxautopolicy",
+			Labels:    serviceLabels,
+			Namespace: namespace,
 		},
 		Spec: corev1.ServiceSpec{
 			Selector: selectorLabels,
@@ -105,7 +124,7 @@ func GetDeployment(namespace string) *appsv1.Deployment {
 					Containers: []corev1.Container{
 						{
 							Name:            "knoxautopolicy",
-							Image:           "accuknox/knoxautopolicy:stable",
+							Image:           defaultImage,
 							ImagePullPolicy: "Always",
 							Ports: []corev1.ContainerPort{
 								{
@@ -162,8 +181,7 @@ func GetClusterRoleBinding(namespace string) *rbacv1.ClusterRoleBinding {
 			APIVersion: "rbac.authorization.k8s.io/v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "knoxautopolicy",
-			Namespace: namespace,
+			Name: "knoxautopolicy",
 		},
 		RoleRef: rbacv1.RoleRef{
 			APIGroup: "rbac.authorization.k8s.io",
@@ -180,169 +198,105 @@ func GetClusterRoleBinding(namespace string) *rbacv1.ClusterRoleBinding {
 	}
 }
 
-var cm = corev1.ConfigMap{
-	TypeMeta: metav1.TypeMeta{
-		Kind:       "ConfigMap",
-		APIVersion: "v1",
-	},
-	ObjectMeta: metav1.ObjectMeta{
-		Name:      "knoxautopolicy-config",
-		Namespace: namespace,
-	},
-	Data: map[string]string{
-		"conf.yaml": `application:
-  name: knoxautopolicy
-  network:
-    operation-mode: 1                         # 1: cronjob | 2: one-time-job
-    cron-job-time-interval: "0h0m10s"         # format: XhYmZs
-    operation-trigger: 1000
-    network-log-from: "hubble"                    # db|hubble
-    network-log-file: "./flow.json"           # file path
-    network-policy-to: "db"              # db, file
-    network-policy-dir: "./"
-    network-policy-types: 3
-    network-policy-rule-types: 511
-  system:
-    operation-mode: 1                         # 1: cronjob | 2: one-time-job
-    cron-job-time-interval: "0h0m10s"         # format: XhYmZs
-    system-log-from: "kubearmor"                     # db|kubearmor
-    system-log-file: "./log.json"             # file path
-    system-policy-to: "db"               # db, file
-    system-policy-dir: "./"
-    deprecate-old-mode: true
-  cluster:
-    cluster-info-from: "k8sclient"            # k8sclient|accuknox
-
-observability: false
-
-database:
-  driver: sqlite3
-  host: mysql.explorer.svc.cluster.local
-  port: 3306
-  user: root
-  password: password
-  dbname: knoxautopolicy
-  table-configuration: auto_policy_config
-  table-network-log: network_log
-  table-network-policy: network_policy
-  table-system-log: system_log
-  table-system-policy: system_policy
-
-feed-consumer:
-  kafka:
-    broker-address-family: v4
-    session-timeout-ms: 6000
-    auto-offset-reset: "earliest"
-    bootstrap-servers: "dev-kafka-kafka-bootstrap.accuknox-dev-kafka.svc.cluster.local:9092"
-    group-id: policy.cilium
-    topics:
-    - cilium-telemetry-new
-    - kubearmor-syslogs
-    ssl:
-      enabled: false
-    events:
-      buffer: 50
-
-logging:
-  level: "INFO"
-
-# kubectl -n kube-system port-forward service/hubble-relay --address 0.0.0.0 --address :: 4245:80
-cilium-hubble:
-  url: hubble-relay.kube-system.svc.cluster.local
-  port: 80
-
-kubearmor:
-  url: kubearmor.kube-system.svc.cluster.local
-  port: 32767`,
-	},
+// getDeployment -- deployment using the configured image, rolled whenever the
+// config changes
+func getDeployment(o Options, cm *corev1.ConfigMap) *appsv1.Deployment {
+	d := GetDeployment(o.Namespace)
+	d.Spec.Template.Spec.Containers[0].Image = o.Image
+	d.Spec.Template.Annotations = map[string]string{
+		configHashAnnotation: configHash(cm),
+	}
+	return d
 }
 
-// DiscoveryEngineInstaller -- Installer for discovery engine
-func DiscoveryEngineInstaller(c *k8s.Client, o Options) error {
-
-	o.Namespace = "explorer"
+// GetConfigMap -- config map holding the rendered discovery-engine config
+func GetConfigMap(namespace string, c *Config) (*corev1.ConfigMap, error) {
+	if err := c.Validate(field.NewPath("config")).ToAggregate(); err != nil {
+		return nil, err
+	}
+	conf, err := c.Render()
+	if err != nil {
+		return nil, err
+	}
 
-	nsName := &corev1.Namespace{
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: o.Namespace,
+			Name:      "knoxautopolicy-config",
+			Namespace: namespace,
 		},
-	}
+		Data: map[string]string{
+			"conf.yaml": conf,
+		},
+	}, nil
+}
 
-	// create explorer namespace
-	if _, err := c.K8sClientset.CoreV1().Namespaces().Create(context.Background(), nsName, metav1.CreateOptions{}); err != nil {
-		log.Print(err.Error())
-	}
+// DiscoveryEngineObjects -- objects created by DiscoveryEngineInstaller
+func DiscoveryEngineObjects(o Options) ([]runtime.Object, error) {
+	o.setDefaults()
 
-	// discovery-engine Service
-	fmt.Print("Discovery-engine Service...\n")
-	if _, err := c.K8sClientset.CoreV1().Services(o.Namespace).Create(context.Background(), GetService(o.Namespace), metav1.CreateOptions{}); err != nil {
-		if !strings.Contains(err.Error(), "already exists") {
-			return err
-		}
-		fmt.Print("Discovery-engine Service already exists...\n")
-	}
-
-	// //discovery-engine dev-config
-	home, err := os.UserHomeDir()
+	cm, err := GetConfigMap(o.Namespace, o.Config)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	config, err := clientcmd.BuildConfigFromFlags("", path.Join(home, ".kube/config"))
-	if err != nil {
-		panic(err.Error())
-	}
+	return []runtime.Object{
+		&corev1.Namespace{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Namespace",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: o.Namespace,
+			},
+		},
+		GetService(o.Namespace),
+		cm,
+		getDeployment(o, cm),
+		GetServiceAccount(o.Namespace),
+		GetClusterRoleBinding(o.Namespace),
+	}, nil
+}
 
-	client, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		panic(err.Error())
-	}
+// DiscoveryEngineInstaller -- Installer for discovery engine. Existing
+// resources that drifted from the desired state are updated unless
+// o.NoOverwrite is set.
+func DiscoveryEngineInstaller(c *k8s.Client, o Options) error {
 
-	namespace := "explorer"
+	o.setDefaults()
 
-	// Create Configmap
-	created, err := client.
-		CoreV1().
-		ConfigMaps(namespace).
-		Create(
-			context.Background(),
-			&cm,
-			metav1.CreateOptions{},
-		)
+	cm, err := GetConfigMap(o.Namespace, o.Config)
 	if err != nil {
-		fmt.Printf("%s\n", err.Error())
-		if !reflect.DeepEqual(created.Data, cm.Data) {
-			fmt.Print("WARN: existing ConfigMap has different data from the default one, not overwriting\n")
-		}
-	} else {
-		fmt.Printf("Created ConfigMap %s/%s\n", namespace, created.GetName())
+		return err
 	}
 
-	// discovery-engine Deployment
-	fmt.Print("KubeArmor Relay Deployment...\n")
-	if _, err := c.K8sClientset.AppsV1().Deployments(o.Namespace).Create(context.Background(), GetDeployment(o.Namespace), metav1.CreateOptions{}); err != nil {
-		if !strings.Contains(err.Error(), "already exists") {
-			return err
-		}
-		fmt.Print("KubeArmor Relay Deployment already exists...\n")
+	nsName := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: o.Namespace,
+		},
 	}
 
-	// discovery-engine Service account
-	fmt.Print("Service Account...\n")
-	if _, err := c.K8sClientset.CoreV1().ServiceAccounts(o.Namespace).Create(context.Background(), GetServiceAccount(o.Namespace), metav1.CreateOptions{}); err != nil {
+	// create discovery-engine namespace
+	if _, err := c.K8sClientset.CoreV1().Namespaces().Create(context.Background(), nsName, metav1.CreateOptions{}); err != nil {
 		if !strings.Contains(err.Error(), "already exists") {
 			return err
 		}
-		fmt.Print("Service Account already exists...\n")
 	}
 
-	// discovery-engine cluster role bindings
-	fmt.Print("Cluster Role Bindings...\n")
-	if _, err := c.K8sClientset.RbacV1().ClusterRoleBindings().Create(context.Background(), GetClusterRoleBinding(o.Namespace), metav1.CreateOptions{}); err != nil {
-		if !strings.Contains(err.Error(), "already exists") {
-			return err
+	resources := []resource{
+		serviceResource(c, GetService(o.Namespace)),
+		configMapResource(c, cm),
+		deploymentResource(c, getDeployment(o, cm)),
+		serviceAccountResource(c, GetServiceAccount(o.Namespace)),
+		clusterRoleBindingResource(c, GetClusterRoleBinding(o.Namespace)),
+	}
+	for _, r := range resources {
+		if err := r.apply(context.Background(), o.NoOverwrite, os.Stdout); err != nil {
+			return fmt.Errorf("unable to apply %s %s: %w", r.kind, r.name, err)
 		}
-		fmt.Print("Cluster Role Bindings already exists...\n")
 	}
 
 	return nil
@@ -439,11 +393,6 @@ func DiscoveryEngineUninstaller(c *k8s.Client, o Options) error {
 		fmt.Print("Cluster Role Bindings not found...\n")
 	}
 
-	// Uninstall MySQL DB
-	fmt.Print("🔥 Uninstalling MySQL...\n")
-	if err := UninstallChart(releaseName, namespace); err != nil {
-		return nil
-	}
 	return nil
 }
 
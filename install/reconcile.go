@@ -0,0 +1,359 @@
+package install
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/kubearmor/kubearmor-client/k8s"
+	"github.com/pmezard/go-difflib/difflib"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// configHashAnnotation -- pod template annotation holding the hash of the
+// config, so that config changes roll the deployment
+const configHashAnnotation = "accuknox.com/config-hash"
+
+// configHash -- hash of the data of the config map
+func configHash(cm *corev1.ConfigMap) string {
+	h := sha256.New()
+	for _, k := range sortedKeys(cm.Data) {
+		fmt.Fprintf(h, "%s\x00%s\x00", k, cm.Data[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// resource -- an object reconciled by the installer. Only the fields owned by
+// the installer are compared and written, values defaulted by the API server
+// are left alone.
+type resource struct {
+	kind string
+	name string
+	// desired -- the owned fields of the object to install
+	desired interface{}
+	// get -- the owned fields of the object in the cluster, nil if it does not exist
+	get func(ctx context.Context) (interface{}, error)
+	// create -- create the object
+	create func(ctx context.Context) error
+	// update -- write the desired owned fields onto the object in the cluster
+	update func(ctx context.Context) error
+}
+
+// apply -- create the resource or bring it back to the desired state, printing
+// what changed. With noOverwrite existing objects are never modified.
+func (r resource) apply(ctx context.Context, noOverwrite bool, w io.Writer) error {
+	current, err := r.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	if current == nil {
+		if err := r.create(ctx); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s %s created\n", r.kind, r.name)
+		return nil
+	}
+
+	if reflect.DeepEqual(current, r.desired) {
+		fmt.Fprintf(w, "%s %s unchanged\n", r.kind, r.name)
+		return nil
+	}
+
+	if noOverwrite {
+		fmt.Fprintf(w, "WARN: existing %s %s differs from the desired one, not overwriting\n", r.kind, r.name)
+		return nil
+	}
+
+	diff, err := diffYAML(current, r.desired)
+	if err != nil {
+		return err
+	}
+	if err := r.update(ctx); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s %s updated\n%s", r.kind, r.name, diff)
+	return nil
+}
+
+// diffYAML -- unified diff of the YAML renderings of a and b
+func diffYAML(a, b interface{}) (string, error) {
+	ya, err := yaml.Marshal(a)
+	if err != nil {
+		return "", err
+	}
+	yb, err := yaml.Marshal(b)
+	if err != nil {
+		return "", err
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(ya)),
+		B:        difflib.SplitLines(string(yb)),
+		FromFile: "current",
+		ToFile:   "desired",
+		Context:  2,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	for _, line := range difflib.SplitLines(diff) {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		out.WriteString("    " + line)
+	}
+	return out.String(), nil
+}
+
+// ignoreNotFound -- nil owned state for objects that do not exist
+func ignoreNotFound(err error) error {
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+type serviceState struct {
+	Labels   map[string]string    `json:"labels,omitempty"`
+	Selector map[string]string    `json:"selector,omitempty"`
+	Ports    []corev1.ServicePort `json:"ports,omitempty"`
+}
+
+func serviceStateOf(s *corev1.Service) serviceState {
+	state := serviceState{Labels: s.Labels, Selector: s.Spec.Selector}
+	for _, p := range s.Spec.Ports {
+		state.Ports = append(state.Ports, corev1.ServicePort{
+			Name:       p.Name,
+			Port:       p.Port,
+			TargetPort: p.TargetPort,
+			Protocol:   p.Protocol,
+		})
+	}
+	return state
+}
+
+func serviceResource(c *k8s.Client, desired *corev1.Service) resource {
+	client := c.K8sClientset.CoreV1().Services(desired.Namespace)
+	var existing *corev1.Service
+
+	return resource{
+		kind:    "Service",
+		name:    desired.Namespace + "/" + desired.Name,
+		desired: serviceStateOf(desired),
+		get: func(ctx context.Context) (interface{}, error) {
+			s, err := client.Get(ctx, desired.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, ignoreNotFound(err)
+			}
+			existing = s
+			return serviceStateOf(s), nil
+		},
+		create: func(ctx context.Context) error {
+			_, err := client.Create(ctx, desired, metav1.CreateOptions{})
+			return err
+		},
+		update: func(ctx context.Context) error {
+			existing.Labels = desired.Labels
+			existing.Spec.Selector = desired.Spec.Selector
+			existing.Spec.Ports = desired.Spec.Ports
+			_, err := client.Update(ctx, existing, metav1.UpdateOptions{})
+			return err
+		},
+	}
+}
+
+type containerState struct {
+	Name            string                 `json:"name"`
+	Image           string                 `json:"image"`
+	ImagePullPolicy corev1.PullPolicy      `json:"imagePullPolicy,omitempty"`
+	Ports           []corev1.ContainerPort `json:"ports,omitempty"`
+	VolumeMounts    []corev1.VolumeMount   `json:"volumeMounts,omitempty"`
+}
+
+type volumeState struct {
+	Name      string `json:"name"`
+	ConfigMap string `json:"configMap,omitempty"`
+}
+
+type deploymentState struct {
+	Labels             map[string]string `json:"labels,omitempty"`
+	Selector           map[string]string `json:"selector,omitempty"`
+	PodLabels          map[string]string `json:"podLabels,omitempty"`
+	ConfigHash         string            `json:"configHash,omitempty"`
+	ServiceAccountName string            `json:"serviceAccountName,omitempty"`
+	Containers         []containerState  `json:"containers,omitempty"`
+	Volumes            []volumeState     `json:"volumes,omitempty"`
+}
+
+func deploymentStateOf(d *appsv1.Deployment) deploymentState {
+	spec := d.Spec.Template.Spec
+	state := deploymentState{
+		Labels:             d.Labels,
+		PodLabels:          d.Spec.Template.Labels,
+		ConfigHash:         d.Spec.Template.Annotations[configHashAnnotation],
+		ServiceAccountName: spec.ServiceAccountName,
+	}
+	if d.Spec.Selector != nil {
+		state.Selector = d.Spec.Selector.MatchLabels
+	}
+	for _, ct := range spec.Containers {
+		state.Containers = append(state.Containers, containerState{
+			Name:            ct.Name,
+			Image:           ct.Image,
+			ImagePullPolicy: ct.ImagePullPolicy,
+			Ports:           ct.Ports,
+			VolumeMounts:    ct.VolumeMounts,
+		})
+	}
+	for _, v := range spec.Volumes {
+		vs := volumeState{Name: v.Name}
+		if v.ConfigMap != nil {
+			vs.ConfigMap = v.ConfigMap.Name
+		}
+		state.Volumes = append(state.Volumes, vs)
+	}
+	return state
+}
+
+func deploymentResource(c *k8s.Client, desired *appsv1.Deployment) resource {
+	client := c.K8sClientset.AppsV1().Deployments(desired.Namespace)
+	var existing *appsv1.Deployment
+
+	return resource{
+		kind:    "Deployment",
+		name:    desired.Namespace + "/" + desired.Name,
+		desired: deploymentStateOf(desired),
+		get: func(ctx context.Context) (interface{}, error) {
+			d, err := client.Get(ctx, desired.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, ignoreNotFound(err)
+			}
+			existing = d
+			return deploymentStateOf(d), nil
+		},
+		create: func(ctx context.Context) error {
+			_, err := client.Create(ctx, desired, metav1.CreateOptions{})
+			return err
+		},
+		update: func(ctx context.Context) error {
+			existing.Labels = desired.Labels
+			existing.Spec.Template = desired.Spec.Template
+			_, err := client.Update(ctx, existing, metav1.UpdateOptions{})
+			return err
+		},
+	}
+}
+
+func serviceAccountResource(c *k8s.Client, desired *corev1.ServiceAccount) resource {
+	client := c.K8sClientset.CoreV1().ServiceAccounts(desired.Namespace)
+
+	// nothing but the existence of the service account is owned
+	return resource{
+		kind:    "ServiceAccount",
+		name:    desired.Namespace + "/" + desired.Name,
+		desired: struct{}{},
+		get: func(ctx context.Context) (interface{}, error) {
+			if _, err := client.Get(ctx, desired.Name, metav1.GetOptions{}); err != nil {
+				return nil, ignoreNotFound(err)
+			}
+			return struct{}{}, nil
+		},
+		create: func(ctx context.Context) error {
+			_, err := client.Create(ctx, desired, metav1.CreateOptions{})
+			return err
+		},
+		update: func(ctx context.Context) error {
+			return nil
+		},
+	}
+}
+
+type clusterRoleBindingState struct {
+	RoleRef  rbacv1.RoleRef   `json:"roleRef"`
+	Subjects []rbacv1.Subject `json:"subjects,omitempty"`
+}
+
+func clusterRoleBindingResource(c *k8s.Client, desired *rbacv1.ClusterRoleBinding) resource {
+	client := c.K8sClientset.RbacV1().ClusterRoleBindings()
+	var existing *rbacv1.ClusterRoleBinding
+
+	return resource{
+		kind:    "ClusterRoleBinding",
+		name:    desired.Name,
+		desired: clusterRoleBindingState{RoleRef: desired.RoleRef, Subjects: desired.Subjects},
+		get: func(ctx context.Context) (interface{}, error) {
+			crb, err := client.Get(ctx, desired.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, ignoreNotFound(err)
+			}
+			existing = crb
+			return clusterRoleBindingState{RoleRef: crb.RoleRef, Subjects: crb.Subjects}, nil
+		},
+		create: func(ctx context.Context) error {
+			_, err := client.Create(ctx, desired, metav1.CreateOptions{})
+			return err
+		},
+		update: func(ctx context.Context) error {
+			// the role of a binding is immutable, it has to be re-created
+			if existing.RoleRef != desired.RoleRef {
+				if err := client.Delete(ctx, desired.Name, metav1.DeleteOptions{}); err != nil {
+					return err
+				}
+				_, err := client.Create(ctx, desired, metav1.CreateOptions{})
+				return err
+			}
+			existing.Subjects = desired.Subjects
+			_, err := client.Update(ctx, existing, metav1.UpdateOptions{})
+			return err
+		},
+	}
+}
+
+func configMapResource(c *k8s.Client, desired *corev1.ConfigMap) resource {
+	client := c.K8sClientset.CoreV1().ConfigMaps(desired.Namespace)
+	var existing *corev1.ConfigMap
+
+	return resource{
+		kind:    "ConfigMap",
+		name:    desired.Namespace + "/" + desired.Name,
+		desired: desired.Data,
+		get: func(ctx context.Context) (interface{}, error) {
+			cm, err := client.Get(ctx, desired.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, ignoreNotFound(err)
+			}
+			existing = cm
+			return cm.Data, nil
+		},
+		create: func(ctx context.Context) error {
+			_, err := client.Create(ctx, desired, metav1.CreateOptions{})
+			return err
+		},
+		update: func(ctx context.Context) error {
+			existing.Data = desired.Data
+			_, err := client.Update(ctx, existing, metav1.UpdateOptions{})
+			return err
+		},
+	}
+}
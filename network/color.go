@@ -4,7 +4,7 @@
 // you may not use this file except in compliance with the License.
 // You may obtain a copy of the License at
 //
-//     http://www.apache.org/licenses/LICENSE-2.0
+//	http://www.apache.org/licenses/LICENSE-2.0
 //
 // Unless required by applicable law or agreed to in writing, software
 // distributed under the License is distributed on an "AS IS" BASIS,
@@ -31,7 +31,7 @@ type colorer struct {
 	yellow  sprinter
 }
 
-func newColorer() *colorer {
+func newColorer(enabled bool) *colorer {
 	red := color.New(color.FgRed)
 	green := color.New(color.FgGreen)
 	blue := color.New(color.FgBlue)
@@ -53,7 +53,7 @@ func newColorer() *colorer {
 		cyan, magenta, yellow,
 	}
 	for _, v := range c.colors {
-		if color.NoColor { // NoColor is global and set dynamically
+		if !enabled {
 			v.DisableColor()
 		} else {
 			v.EnableColor()
@@ -0,0 +1,325 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	"github.com/cilium/cilium/pkg/identity"
+	api "github.com/cilium/cilium/pkg/monitor/api"
+	"google.golang.org/protobuf/proto"
+)
+
+// FilterFlags are the flow filters, in the order they are applied
+var FilterFlags = []string{
+	"from-ip", "to-ip",
+	"from-pod", "to-pod",
+	"from-fqdn", "to-fqdn",
+	"from-label", "to-label",
+	"from-service", "to-service",
+	"from-port", "to-port",
+	"from-identity", "to-identity", "identity",
+	"verdict",
+	"http-status", "http-method", "http-path",
+	"tcp-flag", "ip-version", "nodename",
+	"protocol", "type", "dns-query",
+}
+
+// FilterBuilder composes filter flags into the whitelist and blacklist of a
+// flows request. Filters given one after the other are AND'd into a single
+// group, Or starts a new group that is OR'd with the previous ones. Not negates
+// the filter that follows it. Negated filters are added to the blacklist, each
+// one on its own, so that a flow is dropped as soon as it matches any of them.
+// The blacklist applies to every flow, so negations can only be used in a
+// single group.
+type FilterBuilder struct {
+	// groups of the whitelist. A group is usually a single filter, filters
+	// matching either end of a flow (--identity) split it in alternatives.
+	groups    [][]*flow.FlowFilter
+	blacklist []*flow.FlowFilter
+	// criteria counts the filters added to the last group, negated ones
+	// included
+	criteria int
+	negate   bool
+}
+
+// Add adds the filter to the current group, or to the blacklist after Not
+func (b *FilterBuilder) Add(flag string, value string) error {
+	if b.negate {
+		b.negate = false
+		alternatives, err := addFilter([]*flow.FlowFilter{{}}, flag, value)
+		if err != nil {
+			return err
+		}
+		b.blacklist = append(b.blacklist, alternatives...)
+		b.criteria++
+		return nil
+	}
+
+	if len(b.groups) == 0 {
+		b.groups = [][]*flow.FlowFilter{{{}}}
+	}
+	last := len(b.groups) - 1
+	alternatives, err := addFilter(b.groups[last], flag, value)
+	if err != nil {
+		return err
+	}
+	b.groups[last] = alternatives
+	b.criteria++
+	return nil
+}
+
+// Not negates the next filter
+func (b *FilterBuilder) Not() error {
+	if b.negate {
+		return errors.New("not can not be repeated")
+	}
+	b.negate = true
+	return nil
+}
+
+// Or starts a new group of filters
+func (b *FilterBuilder) Or() error {
+	if b.negate {
+		return errors.New("not must be followed by a filter")
+	}
+	if b.criteria == 0 {
+		return errors.New("or must be placed between filters")
+	}
+	if len(b.groups) == 0 {
+		// the first group only holds negated filters
+		b.groups = [][]*flow.FlowFilter{{{}}}
+	}
+	b.groups = append(b.groups, []*flow.FlowFilter{{}})
+	b.criteria = 0
+	return nil
+}
+
+// Build returns the whitelist and blacklist of the filters
+func (b *FilterBuilder) Build() (whitelist, blacklist []*flow.FlowFilter, err error) {
+	if b.negate {
+		return nil, nil, errors.New("not must be followed by a filter")
+	}
+	if len(b.groups) > 0 && b.criteria == 0 {
+		return nil, nil, errors.New("or must be followed by a filter")
+	}
+	if len(b.groups) > 1 && len(b.blacklist) > 0 {
+		return nil, nil, errors.New("not can not be combined with or: hubble-relay drops the flows matching a negated filter whatever group they match")
+	}
+	for _, alternatives := range b.groups {
+		whitelist = append(whitelist, alternatives...)
+	}
+	return whitelist, b.blacklist, nil
+}
+
+// addFilter adds the filter flag to every alternative of a group. --identity
+// matches either end of the flow and doubles the alternatives.
+func addFilter(alternatives []*flow.FlowFilter, flag string, value string) ([]*flow.FlowFilter, error) {
+	flags := []string{flag}
+	if flag == "identity" {
+		flags = []string{"from-identity", "to-identity"}
+	}
+
+	var filters []*flow.FlowFilter
+	for _, f := range flags {
+		for _, alt := range alternatives {
+			ff := proto.Clone(alt).(*flow.FlowFilter)
+			if err := setFilter(ff, f, value); err != nil {
+				return nil, err
+			}
+			filters = append(filters, ff)
+		}
+	}
+	return filters, nil
+}
+
+// setFilter adds the value of the filter flag to the flow filter
+func setFilter(ff *flow.FlowFilter, flag string, value string) error {
+	switch flag {
+	// ip
+	case "from-ip":
+		ff.SourceIp = append(ff.SourceIp, value)
+	case "to-ip":
+		ff.DestinationIp = append(ff.DestinationIp, value)
+
+	// pod
+	case "from-pod":
+		ff.SourcePod = append(ff.SourcePod, value)
+	case "to-pod":
+		ff.DestinationPod = append(ff.DestinationPod, value)
+
+	// fqdn
+	case "from-fqdn":
+		ff.SourceFqdn = append(ff.SourceFqdn, value)
+	case "to-fqdn":
+		ff.DestinationFqdn = append(ff.DestinationFqdn, value)
+
+	// label
+	case "from-label":
+		ff.SourceLabel = append(ff.SourceLabel, value)
+	case "to-label":
+		ff.DestinationLabel = append(ff.DestinationLabel, value)
+
+	// service
+	case "from-service":
+		ff.SourceService = append(ff.SourceService, value)
+	case "to-service":
+		ff.DestinationService = append(ff.DestinationService, value)
+
+	// port
+	case "from-port":
+		ff.SourcePort = append(ff.SourcePort, value)
+	case "to-port":
+		ff.DestinationPort = append(ff.DestinationPort, value)
+
+	// identity
+	case "from-identity":
+		id, err := parseIdentity(value)
+		if err != nil {
+			return err
+		}
+		ff.SourceIdentity = append(ff.SourceIdentity, id)
+	case "to-identity":
+		id, err := parseIdentity(value)
+		if err != nil {
+			return err
+		}
+		ff.DestinationIdentity = append(ff.DestinationIdentity, id)
+
+	// verdict
+	case "verdict":
+		v, ok := flow.Verdict_value[strings.ToUpper(value)]
+		if !ok {
+			return fmt.Errorf("invalid --verdict: %v", value)
+		}
+		ff.Verdict = append(ff.Verdict, flow.Verdict(v))
+
+	// http
+	case "http-status":
+		ff.HttpStatusCode = append(ff.HttpStatusCode, value)
+	case "http-method":
+		ff.HttpMethod = append(ff.HttpMethod, strings.ToUpper(value))
+	case "http-path":
+		ff.HttpPath = append(ff.HttpPath, value)
+
+	// transport
+	case "tcp-flag":
+		flags, err := parseTCPFlags(value)
+		if err != nil {
+			return err
+		}
+		ff.TcpFlags = append(ff.TcpFlags, flags)
+	case "ip-version":
+		v, err := parseIPVersion(value)
+		if err != nil {
+			return err
+		}
+		ff.IpVersion = append(ff.IpVersion, v)
+	case "protocol":
+		ff.Protocol = append(ff.Protocol, strings.ToLower(value))
+
+	case "nodename":
+		ff.NodeName = append(ff.NodeName, value)
+
+	case "type":
+		t, err := parseEventType(value)
+		if err != nil {
+			return err
+		}
+		ff.EventType = append(ff.EventType, t)
+
+	case "dns-query":
+		ff.DnsQuery = append(ff.DnsQuery, value)
+
+	default:
+		return fmt.Errorf("unknown filter %s", flag)
+	}
+
+	return nil
+}
+
+// parseIdentity accepts a numeric security identity or the name of a reserved
+// one, such as world or host
+func parseIdentity(value string) (uint32, error) {
+	if id, err := identity.ParseNumericIdentity(value); err == nil {
+		return id.Uint32(), nil
+	}
+	if id := identity.GetReservedID(value); id != identity.IdentityUnknown {
+		return id.Uint32(), nil
+	}
+	return 0, fmt.Errorf("invalid identity: %v", value)
+}
+
+// parseTCPFlags accepts a comma separated list of flags that must all be set,
+// such as SYN,ACK
+func parseTCPFlags(value string) (*flow.TCPFlags, error) {
+	flags := &flow.TCPFlags{}
+	for _, f := range strings.Split(value, ",") {
+		switch strings.ToUpper(strings.TrimSpace(f)) {
+		case "FIN":
+			flags.FIN = true
+		case "SYN":
+			flags.SYN = true
+		case "RST":
+			flags.RST = true
+		case "PSH":
+			flags.PSH = true
+		case "ACK":
+			flags.ACK = true
+		case "URG":
+			flags.URG = true
+		case "ECE":
+			flags.ECE = true
+		case "CWR":
+			flags.CWR = true
+		case "NS":
+			flags.NS = true
+		default:
+			return nil, fmt.Errorf("invalid --tcp-flag: %v {FIN|SYN|RST|PSH|ACK|URG|ECE|CWR|NS}", f)
+		}
+	}
+	return flags, nil
+}
+
+func parseIPVersion(value string) (flow.IPVersion, error) {
+	switch strings.ToLower(value) {
+	case "4", "v4", "ipv4":
+		return flow.IPVersion_IPv4, nil
+	case "6", "v6", "ipv6":
+		return flow.IPVersion_IPv6, nil
+	}
+	return flow.IPVersion_IP_NOT_USED, fmt.Errorf("invalid --ip-version: %v {v4|v6}", value)
+}
+
+// parseEventType accepts a type name with an optional sub type, given by name
+// for traces (e.g. trace:to-endpoint) or by number
+func parseEventType(value string) (*flow.EventTypeFilter, error) {
+	name, sub, hasSub := strings.Cut(value, ":")
+	t, ok := api.MessageTypeNames[name]
+	if !ok {
+		return nil, fmt.Errorf("invalid --type: %v {trace|drop|l7|policy-verdict|capture}", value)
+	}
+
+	filter := &flow.EventTypeFilter{Type: int32(t)}
+	if !hasSub {
+		return filter, nil
+	}
+
+	filter.MatchSubType = true
+	if t == api.MessageTypeTrace {
+		for point, pointName := range api.TraceObservationPoints {
+			if pointName == sub {
+				filter.SubType = int32(point)
+				return filter, nil
+			}
+		}
+	}
+	n, err := strconv.ParseUint(sub, 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --type sub type: %v", sub)
+	}
+	filter.SubType = int32(n)
+	return filter, nil
+}
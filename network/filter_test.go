@@ -0,0 +1,182 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	"google.golang.org/protobuf/proto"
+)
+
+// step is a call on the filter builder, a flag name and its value or one of
+// the "not" and "or" operators
+type step struct {
+	flag  string
+	value string
+}
+
+func build(steps []step) ([]*flow.FlowFilter, []*flow.FlowFilter, error) {
+	b := &FilterBuilder{}
+	for _, s := range steps {
+		var err error
+		switch s.flag {
+		case "not":
+			err = b.Not()
+		case "or":
+			err = b.Or()
+		case "filter":
+			err = b.Parse(s.value)
+		default:
+			err = b.Add(s.flag, s.value)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return b.Build()
+}
+
+func equalFilters(t *testing.T, what string, got, want []*flow.FlowFilter) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %d filters %v, want %d %v", what, len(got), got, len(want), want)
+	}
+	for i := range got {
+		if !proto.Equal(got[i], want[i]) {
+			t.Errorf("%s[%d]: got %v, want %v", what, i, got[i], want[i])
+		}
+	}
+}
+
+func TestFilterBuilder(t *testing.T) {
+	tests := []struct {
+		name      string
+		steps     []step
+		whitelist []*flow.FlowFilter
+		blacklist []*flow.FlowFilter
+	}{
+		{
+			name: "no filters",
+		},
+		{
+			name:      "flags are AND'd",
+			steps:     []step{{"from-pod", "default/web"}, {"verdict", "DROPPED"}},
+			whitelist: []*flow.FlowFilter{{SourcePod: []string{"default/web"}, Verdict: []flow.Verdict{flow.Verdict_DROPPED}}},
+		},
+		{
+			name:      "repeated flags match any value",
+			steps:     []step{{"to-port", "53"}, {"to-port", "443"}},
+			whitelist: []*flow.FlowFilter{{DestinationPort: []string{"53", "443"}}},
+		},
+		{
+			name:  "or starts a new group",
+			steps: []step{{"from-pod", "default/web"}, {"or", ""}, {"to-pod", "default/db"}, {"protocol", "TCP"}},
+			whitelist: []*flow.FlowFilter{
+				{SourcePod: []string{"default/web"}},
+				{DestinationPod: []string{"default/db"}, Protocol: []string{"tcp"}},
+			},
+		},
+		{
+			name:      "not negates the next flag only",
+			steps:     []step{{"not", ""}, {"verdict", "FORWARDED"}, {"from-pod", "default/web"}},
+			whitelist: []*flow.FlowFilter{{SourcePod: []string{"default/web"}}},
+			blacklist: []*flow.FlowFilter{{Verdict: []flow.Verdict{flow.Verdict_FORWARDED}}},
+		},
+		{
+			name:  "negations are independent",
+			steps: []step{{"not", ""}, {"to-port", "53"}, {"not", ""}, {"from-ip", "10.0.0.1"}},
+			blacklist: []*flow.FlowFilter{
+				{DestinationPort: []string{"53"}},
+				{SourceIp: []string{"10.0.0.1"}},
+			},
+		},
+		{
+			name:  "identity matches either end",
+			steps: []step{{"verdict", "DROPPED"}, {"identity", "world"}},
+			whitelist: []*flow.FlowFilter{
+				{Verdict: []flow.Verdict{flow.Verdict_DROPPED}, SourceIdentity: []uint32{2}},
+				{Verdict: []flow.Verdict{flow.Verdict_DROPPED}, DestinationIdentity: []uint32{2}},
+			},
+		},
+		{
+			name:  "l7 and transport filters",
+			steps: []step{{"http-method", "get"}, {"http-status", "5+"}, {"tcp-flag", "SYN,ACK"}, {"ip-version", "v4"}, {"type", "l7"}},
+			whitelist: []*flow.FlowFilter{{
+				HttpMethod:     []string{"GET"},
+				HttpStatusCode: []string{"5+"},
+				TcpFlags:       []*flow.TCPFlags{{SYN: true, ACK: true}},
+				IpVersion:      []flow.IPVersion{flow.IPVersion_IPv4},
+				EventType:      []*flow.EventTypeFilter{{Type: 129}},
+			}},
+		},
+		{
+			name:      "query",
+			steps:     []step{{"filter", "from-pod=default/web and verdict=DROPPED"}},
+			whitelist: []*flow.FlowFilter{{SourcePod: []string{"default/web"}, Verdict: []flow.Verdict{flow.Verdict_DROPPED}}},
+		},
+		{
+			name:      "query with negations",
+			steps:     []step{{"filter", "from-pod=default/web and not to-port=53 and verdict!=FORWARDED"}},
+			whitelist: []*flow.FlowFilter{{SourcePod: []string{"default/web"}}},
+			blacklist: []*flow.FlowFilter{
+				{DestinationPort: []string{"53"}},
+				{Verdict: []flow.Verdict{flow.Verdict_FORWARDED}},
+			},
+		},
+		{
+			name:      "query with quoted values",
+			steps:     []step{{"filter", `from-label="app=web tier" && dns-query='.*\.io'`}},
+			whitelist: []*flow.FlowFilter{{SourceLabel: []string{"app=web tier"}, DnsQuery: []string{`.*\.io`}}},
+		},
+		{
+			name:      "query continues the group of the flags before it",
+			steps:     []step{{"from-pod", "default/web"}, {"filter", "verdict=DROPPED"}},
+			whitelist: []*flow.FlowFilter{{SourcePod: []string{"default/web"}, Verdict: []flow.Verdict{flow.Verdict_DROPPED}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			whitelist, blacklist, err := build(tt.steps)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			equalFilters(t, "whitelist", whitelist, tt.whitelist)
+			equalFilters(t, "blacklist", blacklist, tt.blacklist)
+		})
+	}
+}
+
+func TestFilterBuilderErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"not at the end", []step{{"from-pod", "default/web"}, {"not", ""}}},
+		{"not twice", []step{{"not", ""}, {"not", ""}}},
+		{"not before or", []step{{"from-pod", "default/web"}, {"not", ""}, {"or", ""}}},
+		{"or first", []step{{"or", ""}, {"from-pod", "default/web"}}},
+		{"or at the end", []step{{"from-pod", "default/web"}, {"or", ""}}},
+		{"not with or", []step{{"from-pod", "default/web"}, {"or", ""}, {"not", ""}, {"to-port", "53"}}},
+		{"not in the first group with or", []step{{"not", ""}, {"verdict", "DROPPED"}, {"or", ""}, {"from-pod", "default/web"}}},
+		{"invalid verdict", []step{{"verdict", "MAYBE"}}},
+		{"invalid tcp flag", []step{{"tcp-flag", "SYN,FOO"}}},
+		{"invalid type", []step{{"type", "packet"}}},
+		{"empty query", []step{{"filter", "  "}}},
+		{"unknown key", []step{{"filter", "pod=web"}}},
+		{"missing operator", []step{{"filter", "from-pod=web to-pod=db"}}},
+		{"dangling and", []step{{"filter", "from-pod=web and"}}},
+		{"negation with or", []step{{"filter", "from-pod=a or to-pod=b and verdict!=FORWARDED"}}},
+		{"not after or", []step{{"filter", "from-pod=default/web and verdict=DROPPED or not to-port=53"}}},
+		{"leading or", []step{{"filter", "or from-pod=web"}}},
+		{"missing value", []step{{"filter", "from-pod="}}},
+		{"unterminated quote", []step{{"filter", `from-label="app=web`}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := build(tt.steps); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -25,6 +25,7 @@ import (
 	observerpb "github.com/cilium/cilium/api/v1/observer"
 	identity "github.com/cilium/cilium/pkg/identity"
 	api "github.com/cilium/cilium/pkg/monitor/api"
+	"github.com/fatih/color"
 	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -70,8 +71,11 @@ func getSecurityIdentities(f *pb.Flow, fd *FlowData) {
 
 // WriteProtoFlow function
 func WriteProtoFlow(res *observerpb.GetFlowsResponse) *FlowData {
+	return getFlowData(res.GetFlow())
+}
+
+func getFlowData(f *pb.Flow) *FlowData {
 	fd := new(FlowData)
-	f := res.GetFlow()
 	gethostNames(f, fd)
 	getSecurityIdentities(f, fd)
 
@@ -220,5 +224,5 @@ func getFlowType(f *pb.Flow) string {
 }
 
 func init() {
-	c = newColorer()
+	c = newColorer(!color.NoColor) // NoColor is global and set dynamically
 }
@@ -2,11 +2,12 @@ package network
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"os"
+	"time"
 
+	"github.com/accuknox/accuknox-cli/grpcutil"
 	"github.com/cilium/cilium/api/v1/flow"
 	"github.com/cilium/cilium/api/v1/observer"
 	"google.golang.org/grpc"
@@ -14,157 +15,113 @@ import (
 
 // Options Structure
 type Options struct {
-	Follow    bool
+	Server string
+	Follow bool
+	// Output format of the flows, one of Outputs
+	Output string
+	// Since and Until bound the flows to a time window, as RFC3339 timestamps
+	// or durations relative to now
+	Since string
+	Until string
+	// First and Last limit the flows to the oldest or newest ones
+	First uint64
+	Last  uint64
+
+	// TLS enables TLS on the connection to hubble-relay, with the CA and the
+	// client certificate read from files or loaded with LoadTLSSecret
+	TLS           bool
+	TLSCACert     string
+	TLSClientCert string
+	TLSClientKey  string
+	TLSServerName string
+	// Timeout of the connection to hubble-relay
+	Timeout time.Duration
+
+	// Stats counts the flows instead of printing them, refreshing a table of
+	// the StatsTop busiest flows every StatsInterval
+	Stats         bool
+	StatsInterval time.Duration
+	StatsTop      int
+
+	// Record is the file the flows are recorded to, one JSON object per line
+	Record string
+	// FromFile is a file of recorded flows to replay instead of connecting to
+	// hubble-relay
+	FromFile string
+
+	tlsCA     []byte
+	tlsCert   []byte
+	tlsKey    []byte
 	whitelist []*flow.FlowFilter
 	blacklist []*flow.FlowFilter
 }
 
+// DefaultServer is the hubble-relay address used when none is given
+const DefaultServer = "localhost:4245"
+
 // StopChan Channel
 var (
 	StopChan chan struct{}
 )
 
-// ConnectHubbleRelay Function
-func ConnectHubbleRelay() (*grpc.ClientConn, error) {
-	addr := "localhost:4245"
+// DefaultTimeout of the connection to hubble-relay
+const DefaultTimeout = 5 * time.Second
 
-	conn, err := grpc.Dial(addr, grpc.WithInsecure())
-	if err != nil {
-
-		return nil, err
+// serverAddr returns the address of hubble-relay
+func serverAddr(o Options) string {
+	if o.Server == "" {
+		return DefaultServer
 	}
-
-	return conn, err
+	return o.Server
 }
 
-func UpdateBlackList(o *Options, flag string, value string) {
-	ff := &flow.FlowFilter{}
-
-	switch flag {
-	// ip
-	case "from-ip":
-		ff.SourceIp = append(ff.SourceIp, value)
-	case "to-ip":
-		ff.DestinationIp = append(ff.DestinationIp, value)
-
-	// pod
-	case "from-pod":
-		ff.SourcePod = append(ff.SourcePod, value)
-
-	case "to-pod":
-		ff.DestinationPod = append(ff.DestinationPod, value)
-
-	// fqdn
-	case "from-fqdn":
-		ff.SourceFqdn = append(ff.SourceFqdn, value)
-
-	case "to-fqdn":
-		ff.DestinationFqdn = append(ff.DestinationFqdn, value)
-
-	// label
-	case "from-label":
-		ff.SourceLabel = append(ff.SourceLabel, value)
-
-	case "to-label":
-		ff.DestinationLabel = append(ff.DestinationLabel, value)
-
-	// service
-	case "from-service":
-
-		ff.SourceService = append(ff.SourceService, value)
-
-	case "to-service":
-		ff.DestinationService = append(ff.DestinationService, value)
-
-	// port
-	case "from-port":
-		ff.SourcePort = append(ff.SourcePort, value)
-
-	case "to-port":
-		ff.DestinationPort = append(ff.DestinationPort, value)
-
-	// verdict
-	case "verdict":
-		v, ok := flow.Verdict_value[value]
-
-		if !ok {
-			fmt.Printf("invalid --verdict: %v", value)
-			os.Exit(1)
-		}
-		ff.Verdict = append(ff.Verdict, flow.Verdict(v))
+// ConnectHubbleRelay Function
+func ConnectHubbleRelay(o Options) (*grpc.ClientConn, error) {
+	addr := serverAddr(o)
+	timeout := o.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
 
-		// TODO --http-status, --http-method, --http-path, --tcp-flag, --ip-version, --nodename
+	creds, err := transportCredentials(o)
+	if err != nil {
+		return nil, err
 	}
 
-	o.blacklist = append(o.blacklist, ff)
+	conn, err := grpcutil.Dial(addr, creds, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to hubble-relay at %s: %w", addr, err)
+	}
+	return conn, nil
 }
 
-func UpdateWhiteList(o *Options, flag string, value string) {
-	ff := &flow.FlowFilter{}
-
-	switch flag {
-	// ip
-	case "from-ip":
-		ff.SourceIp = append(ff.SourceIp, value)
-	case "to-ip":
-		ff.DestinationIp = append(ff.DestinationIp, value)
-
-	// pod
-	case "from-pod":
-		ff.SourcePod = append(ff.SourcePod, value)
-
-	case "to-pod":
-		ff.DestinationPod = append(ff.DestinationPod, value)
-
-	// fqdn
-	case "from-fqdn":
-		ff.SourceFqdn = append(ff.SourceFqdn, value)
-
-	case "to-fqdn":
-		ff.DestinationFqdn = append(ff.DestinationFqdn, value)
-
-	// label
-	case "from-label":
-		ff.SourceLabel = append(ff.SourceLabel, value)
-
-	case "to-label":
-		ff.DestinationLabel = append(ff.DestinationLabel, value)
-
-	// service
-	case "from-service":
-
-		ff.SourceService = append(ff.SourceService, value)
-
-	case "to-service":
-		ff.DestinationService = append(ff.DestinationService, value)
-
-	// port
-	case "from-port":
-		ff.SourcePort = append(ff.SourcePort, value)
-
-	case "to-port":
-		ff.DestinationPort = append(ff.DestinationPort, value)
-
-	// verdict
-	case "verdict":
-		v, ok := flow.Verdict_value[value]
-
-		if !ok {
-			fmt.Printf("invalid --verdict: %v", value)
-			os.Exit(1)
-		}
-		ff.Verdict = append(ff.Verdict, flow.Verdict(v))
+// SetFilters sets the whitelist and blacklist of the flows request
+func (o *Options) SetFilters(b *FilterBuilder) error {
+	whitelist, blacklist, err := b.Build()
+	if err != nil {
+		return err
 	}
-	// TODO --http-status, --http-method, --http-path, --tcp-flag, --ip-version, --nodename
-
-	o.whitelist = append(o.whitelist, ff)
-
+	o.whitelist = whitelist
+	o.blacklist = blacklist
+	return nil
 }
 
 // StartHubbleRelay Function
 func StartHubbleRelay(o Options) error {
+	req, tail, err := flowsRequest(o, time.Now())
+	if err != nil {
+		return err
+	}
 
-	conn, err := ConnectHubbleRelay()
+	p, err := newPipeline(o, os.Stdout, tail)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = p.close()
+	}()
+
+	conn, err := ConnectHubbleRelay(o)
 	if err != nil {
 		return err
 	}
@@ -175,64 +132,69 @@ func StartHubbleRelay(o Options) error {
 
 	client := observer.NewObserverClient(conn)
 
-	var num uint64
-	switch {
-	case o.Follow:
-		num = ^uint64(0)
-	default:
-		num = 20
-	}
-
-	req := &observer.GetFlowsRequest{
-		Number:    num,
-		Follow:    o.Follow,
-		Whitelist: o.whitelist,
-		Blacklist: o.blacklist,
-		Since:     nil,
-		Until:     nil,
-	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	stream, err := client.GetFlows(context.Background(), req)
+	stream, err := client.GetFlows(ctx, req)
 	if err != nil {
-		err = errors.New("failed to connect to the gRPC server\nPossible troubleshooting:\n- Check if Hubble relay is running\n- Create a portforward to hubble relay service using\n\t\033[1maccuknox port-forward cilium\033[0m")
+		return fmt.Errorf("unable to read flows from %s: %w", serverAddr(o), err)
+	}
+	if err := p.startRecord(o.Record); err != nil {
 		return err
 	}
+
+	// the stream is read in the background so that the stats table is
+	// refreshed while no flow arrives
+	flows := make(chan *flow.Flow)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			res, err := stream.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+			f := res.GetFlow()
+			if f == nil {
+				continue
+			}
+			select {
+			case flows <- f:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var refresh <-chan time.Time
+	if o.Stats {
+		interval := o.StatsInterval
+		if interval <= 0 {
+			interval = DefaultStatsInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+
 	for {
 		select {
 		case <-StopChan:
-			return nil
-
-		default:
-			res, err := stream.Recv()
+			return p.finish()
 
+		case err := <-errs:
 			if err == io.EOF {
-				return nil
+				return p.finish()
 			}
+			return err
 
-			if err != nil {
+		case f := <-flows:
+			if err := p.handle(f); err != nil {
 				return err
 			}
 
-			switch res.ResponseTypes.(type) {
-			case *observer.GetFlowsResponse_Flow:
-				fd := WriteProtoFlow(res)
-				_, err := fmt.Fprintf(os.Stdout,
-					"%s%s: %s %s %s %s %s %s %s \n",
-					fd.Timestamp,
-					fd.Node,
-					fd.Source,
-					fd.SourceIdentity,
-					fd.Arrow,
-					fd.Destination,
-					fd.DestinationIdentity,
-					fd.FlowType,
-					fd.Verdict)
-
-				if err != nil {
-					return fmt.Errorf("failed to write out packet: %v", err)
-				}
-			}
+		case <-refresh:
+			p.refresh()
 		}
 	}
-
 }
@@ -0,0 +1,113 @@
+package network
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cilium/cilium/api/v1/flow"
+)
+
+// pipeline writes the flows received from hubble-relay or replayed from a
+// file, or counts them in stats mode
+type pipeline struct {
+	w       io.Writer
+	printer *printer
+	stats   *stats
+	// tail is the number of newest flows kept until the stream ends, when the
+	// relay can not select them itself
+	tail uint64
+	last []*flow.Flow
+	// record is the file every flow handled is recorded to
+	record *os.File
+}
+
+func newPipeline(o Options, w io.Writer, tail uint64) (*pipeline, error) {
+	p := &pipeline{w: w, tail: tail}
+	if o.Stats {
+		p.stats = newStats(o.StatsTop)
+	} else {
+		printer, err := newPrinter(o.Output, w)
+		if err != nil {
+			return nil, err
+		}
+		p.printer = printer
+	}
+	return p, nil
+}
+
+// startRecord creates the file the flows are recorded to. It is called once
+// the flows can be read, so that a previous recording is not truncated when
+// hubble-relay can not be reached.
+func (p *pipeline) startRecord(path string) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to record the flows: %w", err)
+	}
+	p.record = f
+	return nil
+}
+
+func (p *pipeline) handle(f *flow.Flow) error {
+	if p.record != nil {
+		if err := writeJSONLine(p.record, f); err != nil {
+			return fmt.Errorf("unable to record the flows: %w", err)
+		}
+	}
+
+	if p.tail > 0 {
+		p.last = append(p.last, f)
+		if uint64(len(p.last)) > p.tail {
+			p.last = p.last[1:]
+		}
+		return nil
+	}
+	return p.emit(f)
+}
+
+func (p *pipeline) emit(f *flow.Flow) error {
+	if p.stats != nil {
+		p.stats.add(f)
+		return nil
+	}
+	return p.printer.WriteFlow(f)
+}
+
+// refresh redraws the stats table, in place on terminals
+func (p *pipeline) refresh() {
+	if p.stats == nil {
+		return
+	}
+	if isTerminal(p.w) {
+		fmt.Fprint(p.w, "\033[H\033[2J")
+	}
+	p.stats.printTable(p.w)
+}
+
+// finish writes the flows kept until the end of the stream and the final
+// stats summary
+func (p *pipeline) finish() error {
+	for _, f := range p.last {
+		if err := p.emit(f); err != nil {
+			return err
+		}
+	}
+	p.last = nil
+
+	if p.stats != nil {
+		p.stats.printTable(p.w)
+		p.stats.printSummary(p.w)
+	}
+	return nil
+}
+
+// close closes the record file
+func (p *pipeline) close() error {
+	if p.record == nil {
+		return nil
+	}
+	return p.record.Close()
+}
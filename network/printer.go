@@ -0,0 +1,158 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	"github.com/fatih/color"
+	"golang.org/x/exp/slices"
+	"golang.org/x/term"
+	"google.golang.org/protobuf/encoding/protojson"
+	"sigs.k8s.io/yaml"
+)
+
+// Output formats of the flows
+const (
+	OutputCompact = "compact"
+	OutputDict    = "dict"
+	OutputJSON    = "json"
+	OutputJSONL   = "jsonl"
+	OutputYAML    = "yaml"
+)
+
+// Outputs lists the supported output formats
+var Outputs = []string{OutputCompact, OutputDict, OutputJSON, OutputJSONL, OutputYAML}
+
+// printer writes flows in the selected output format
+type printer struct {
+	output string
+	w      io.Writer
+	// count of the flows written, used to separate dict and yaml entries
+	count int
+}
+
+func newPrinter(output string, w io.Writer) (*printer, error) {
+	if output == "" {
+		output = OutputCompact
+	}
+	if !slices.Contains(Outputs, output) {
+		return nil, fmt.Errorf("invalid output format %q, expected one of %s", output, strings.Join(Outputs, "|"))
+	}
+
+	// colours are only written to terminals
+	c = newColorer(isTerminal(w) && !color.NoColor)
+
+	return &printer{output: output, w: w}, nil
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// WriteFlow writes one flow
+func (p *printer) WriteFlow(f *flow.Flow) error {
+	var err error
+	switch p.output {
+	case OutputJSON:
+		err = p.writeJSON(f, protojson.MarshalOptions{Multiline: true, Indent: "  "})
+	case OutputJSONL:
+		err = p.writeJSON(f, protojson.MarshalOptions{})
+	case OutputYAML:
+		err = p.writeYAML(f)
+	case OutputDict:
+		err = p.writeDict(f)
+	default:
+		err = p.writeCompact(f)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write out packet: %v", err)
+	}
+	p.count++
+	return nil
+}
+
+func (p *printer) writeJSON(f *flow.Flow, opts protojson.MarshalOptions) error {
+	if !opts.Multiline {
+		return writeJSONLine(p.w, f)
+	}
+	b, err := opts.Marshal(f)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(p.w, string(b))
+	return err
+}
+
+// writeJSONLine writes the flow as a single line of JSON, the format of
+// --record and of the jsonl output
+func writeJSONLine(w io.Writer, f *flow.Flow) error {
+	b, err := protojson.Marshal(f)
+	if err != nil {
+		return err
+	}
+	// protojson randomly adds spaces to single-line output, the object is
+	// compacted so that the output is stable
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func (p *printer) writeYAML(f *flow.Flow) error {
+	b, err := protojson.Marshal(f)
+	if err != nil {
+		return err
+	}
+	y, err := yaml.JSONToYAML(b)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(p.w, "---\n%s", y)
+	return err
+}
+
+func (p *printer) writeDict(f *flow.Flow) error {
+	fd := getFlowData(f)
+	if p.count > 0 {
+		if _, err := fmt.Fprintln(p.w, "------------"); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(p.w,
+		"  TIMESTAMP: %s\n       NODE: %s\n     SOURCE: %s %s\nDESTINATION: %s %s\n  DIRECTION: %s\n       TYPE: %s\n    VERDICT: %s\n",
+		fd.Timestamp,
+		f.GetNodeName(),
+		fd.Source,
+		fd.SourceIdentity,
+		fd.Destination,
+		fd.DestinationIdentity,
+		fd.Arrow,
+		fd.FlowType,
+		fd.Verdict)
+	return err
+}
+
+func (p *printer) writeCompact(f *flow.Flow) error {
+	fd := getFlowData(f)
+	_, err := fmt.Fprintf(p.w,
+		"%s%s: %s %s %s %s %s %s %s \n",
+		fd.Timestamp,
+		fd.Node,
+		fd.Source,
+		fd.SourceIdentity,
+		fd.Arrow,
+		fd.Destination,
+		fd.DestinationIdentity,
+		fd.FlowType,
+		fd.Verdict)
+	return err
+}
@@ -0,0 +1,135 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Parse adds the filters of a query such as
+//
+//	from-pod=default/web and verdict=DROPPED or to-pod=default/db
+//
+// The keys are the names of the filter flags. "and" binds tighter than "or",
+// "not key=value" and "key!=value" negate a filter, in queries without "or"
+// only. Values holding spaces can be quoted.
+func (b *FilterBuilder) Parse(query string) error {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return errors.New("empty filter")
+	}
+
+	expectTerm := true
+	for _, tok := range tokens {
+		switch strings.ToLower(tok) {
+		case "and", "&&":
+			if expectTerm {
+				return fmt.Errorf("unexpected %q", tok)
+			}
+			expectTerm = true
+
+		case "or", "||":
+			if expectTerm {
+				return fmt.Errorf("unexpected %q", tok)
+			}
+			if err := b.Or(); err != nil {
+				return err
+			}
+			expectTerm = true
+
+		case "not", "!":
+			if !expectTerm {
+				return fmt.Errorf("expected and/or before %q", tok)
+			}
+			if err := b.Not(); err != nil {
+				return err
+			}
+
+		default:
+			if !expectTerm {
+				return fmt.Errorf("expected and/or before %q", tok)
+			}
+			key, value, negate, err := splitTerm(tok)
+			if err != nil {
+				return err
+			}
+			if negate {
+				if err := b.Not(); err != nil {
+					return err
+				}
+			}
+			if err := b.Add(key, value); err != nil {
+				return err
+			}
+			expectTerm = false
+		}
+	}
+
+	if expectTerm {
+		return fmt.Errorf("incomplete filter %q", query)
+	}
+	return nil
+}
+
+// splitTerm splits key=value or key!=value
+func splitTerm(term string) (key, value string, negate bool, err error) {
+	i := strings.Index(term, "=")
+	if i <= 0 {
+		return "", "", false, fmt.Errorf("invalid filter %q, expected key=value", term)
+	}
+	key, value = term[:i], term[i+1:]
+	if strings.HasSuffix(key, "!") {
+		key, negate = strings.TrimSuffix(key, "!"), true
+	}
+	if !slices.Contains(FilterFlags, key) {
+		return "", "", false, fmt.Errorf("unknown filter %q, expected one of %s", key, strings.Join(FilterFlags, ", "))
+	}
+	if value == "" {
+		return "", "", false, fmt.Errorf("missing value for filter %q", key)
+	}
+	return key, value, negate, nil
+}
+
+// tokenize splits the query on whitespace, keeping quoted sections together
+// and dropping the quotes
+func tokenize(query string) ([]string, error) {
+	var tokens []string
+	var tok strings.Builder
+	var quote rune
+	inToken := false
+
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				tok.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inToken = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inToken {
+				tokens = append(tokens, tok.String())
+				tok.Reset()
+				inToken = false
+			}
+		default:
+			tok.WriteRune(r)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in filter %q", query)
+	}
+	if inToken {
+		tokens = append(tokens, tok.String())
+	}
+	return tokens, nil
+}
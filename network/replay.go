@@ -0,0 +1,124 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	"github.com/cilium/cilium/api/v1/observer"
+	v1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	"github.com/cilium/cilium/pkg/hubble/filters"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// maxLineSize is the size of the longest flow that can be replayed
+const maxLineSize = 1024 * 1024
+
+// ReplayFlows reads the flows recorded with --record, or written with the
+// jsonl output, from o.FromFile ("-" for stdin). They go through the same
+// filters, time window, output and stats as the flows of hubble-relay, the
+// filters being applied locally the way the relay applies them.
+func ReplayFlows(o Options) error {
+	if o.Follow {
+		return errors.New("--follow can not be used with --from-file")
+	}
+	// the request is only built to validate the options and parse the window
+	req, _, err := flowsRequest(o, time.Now())
+	if err != nil {
+		return err
+	}
+
+	whitelist, err := filters.BuildFilterList(context.Background(), o.whitelist, filters.DefaultFilters)
+	if err != nil {
+		return err
+	}
+	blacklist, err := filters.BuildFilterList(context.Background(), o.blacklist, filters.DefaultFilters)
+	if err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if o.FromFile != "-" {
+		f, err := os.Open(o.FromFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	p, err := newPipeline(o, os.Stdout, o.Last)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = p.close()
+	}()
+	if err := p.startRecord(o.Record); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	var line, count uint64
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		f, err := unmarshalFlow(scanner.Bytes())
+		if err != nil {
+			return fmt.Errorf("%s:%d: invalid flow: %w", o.FromFile, line, err)
+		}
+
+		if !inWindow(f, req) || !filters.Apply(whitelist, blacklist, &v1.Event{Timestamp: f.GetTime(), Event: f}) {
+			continue
+		}
+		if err := p.handle(f); err != nil {
+			return err
+		}
+		if count++; o.First > 0 && count >= o.First {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return p.finish()
+}
+
+// unmarshalFlow accepts a flow, or a GetFlows response as written by
+// hubble observe -o jsonpb
+func unmarshalFlow(b []byte) (*flow.Flow, error) {
+	f := &flow.Flow{}
+	err := protojson.Unmarshal(b, f)
+	if err == nil {
+		return f, nil
+	}
+
+	res := &observer.GetFlowsResponse{}
+	if protojson.Unmarshal(b, res) == nil && res.GetFlow() != nil {
+		return res.GetFlow(), nil
+	}
+	return nil, err
+}
+
+func inWindow(f *flow.Flow, req *observer.GetFlowsRequest) bool {
+	if req.Since == nil && req.Until == nil {
+		return true
+	}
+	ts := f.GetTime().AsTime()
+	if req.Since != nil && ts.Before(req.Since.AsTime()) {
+		return false
+	}
+	if req.Until != nil && ts.After(req.Until.AsTime()) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/observer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// defaultLast is the number of flows shown when no window is requested
+const defaultLast = 20
+
+// ParseTime accepts an RFC3339 timestamp or a duration relative to now, such
+// as 5m or 1h30m
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected an RFC3339 timestamp or a relative duration such as 5m", s)
+	}
+	if d < 0 {
+		d = -d
+	}
+	return now.Add(-d), nil
+}
+
+// flowsRequest builds the GetFlows request of the options. The relay has no
+// way to return the newest flows of a time window, for --last with --since or
+// --until every flow of the window is requested and the returned tail is the
+// number of flows to keep client side.
+func flowsRequest(o Options, now time.Time) (req *observer.GetFlowsRequest, tail uint64, err error) {
+	if o.First > 0 && o.Last > 0 {
+		return nil, 0, errors.New("--first and --last can not be used together")
+	}
+	if o.First > 0 && o.Follow {
+		return nil, 0, errors.New("--first can not be used with --follow")
+	}
+
+	req = &observer.GetFlowsRequest{
+		Follow:    o.Follow,
+		Whitelist: o.whitelist,
+		Blacklist: o.blacklist,
+	}
+
+	var since, until time.Time
+	if o.Since != "" {
+		if since, err = ParseTime(o.Since, now); err != nil {
+			return nil, 0, fmt.Errorf("invalid --since: %w", err)
+		}
+		req.Since = timestamppb.New(since)
+	}
+	if o.Until != "" {
+		if o.Follow {
+			return nil, 0, errors.New("--until can not be used with --follow")
+		}
+		if until, err = ParseTime(o.Until, now); err != nil {
+			return nil, 0, fmt.Errorf("invalid --until: %w", err)
+		}
+		if req.Since != nil && until.Before(since) {
+			return nil, 0, errors.New("--until is before --since")
+		}
+		req.Until = timestamppb.New(until)
+	}
+	window := req.Since != nil || req.Until != nil
+
+	switch {
+	case o.First > 0:
+		// the relay reads forward from the oldest flow after since
+		if req.Since == nil {
+			req.Since = timestamppb.New(time.Unix(0, 0))
+		}
+		req.Number = o.First
+	case o.Last > 0 && window && !o.Follow:
+		tail = o.Last
+	case o.Last > 0:
+		req.Number = o.Last
+	case window:
+		// every flow of the window
+	case o.Follow:
+		// every buffered flow, then the new ones
+		req.Number = ^uint64(0)
+	default:
+		req.Number = defaultLast
+	}
+
+	return req, tail, nil
+}
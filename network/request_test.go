@@ -0,0 +1,158 @@
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/observer"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value string
+		want  time.Time
+	}{
+		{"timestamp", "2022-06-01T10:30:00Z", time.Date(2022, 6, 1, 10, 30, 0, 0, time.UTC)},
+		{"timestamp with nanoseconds", "2022-06-01T10:30:00.5Z", time.Date(2022, 6, 1, 10, 30, 0, 500000000, time.UTC)},
+		{"duration", "5m", now.Add(-5 * time.Minute)},
+		{"compound duration", "1h30m", now.Add(-90 * time.Minute)},
+		{"negative duration is in the past too", "-5m", now.Add(-5 * time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTime(tt.value, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, value := range []string{"", "yesterday", "2022-06-01"} {
+		if _, err := ParseTime(value, now); err == nil {
+			t.Errorf("ParseTime(%q): expected an error", value)
+		}
+	}
+}
+
+func TestFlowsRequest(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *timestamppb.Timestamp {
+		return timestamppb.New(now.Add(-d))
+	}
+	tests := []struct {
+		name string
+		opts Options
+		want *observer.GetFlowsRequest
+		tail uint64
+	}{
+		{
+			name: "default",
+			want: &observer.GetFlowsRequest{Number: defaultLast},
+		},
+		{
+			name: "last",
+			opts: Options{Last: 5},
+			want: &observer.GetFlowsRequest{Number: 5},
+		},
+		{
+			name: "first reads from the oldest flow",
+			opts: Options{First: 5},
+			want: &observer.GetFlowsRequest{Number: 5, Since: timestamppb.New(time.Unix(0, 0))},
+		},
+		{
+			name: "first after since",
+			opts: Options{First: 5, Since: "10m"},
+			want: &observer.GetFlowsRequest{Number: 5, Since: at(10 * time.Minute)},
+		},
+		{
+			name: "first before until",
+			opts: Options{First: 5, Until: "10m"},
+			want: &observer.GetFlowsRequest{Number: 5, Since: timestamppb.New(time.Unix(0, 0)), Until: at(10 * time.Minute)},
+		},
+		{
+			name: "since requests the whole window",
+			opts: Options{Since: "10m"},
+			want: &observer.GetFlowsRequest{Since: at(10 * time.Minute)},
+		},
+		{
+			name: "since and until",
+			opts: Options{Since: "2022-06-01T10:00:00Z", Until: "1h"},
+			want: &observer.GetFlowsRequest{
+				Since: timestamppb.New(time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)),
+				Until: at(time.Hour),
+			},
+		},
+		{
+			name: "last in a window is trimmed client side",
+			opts: Options{Last: 5, Since: "10m", Until: "5m"},
+			want: &observer.GetFlowsRequest{Since: at(10 * time.Minute), Until: at(5 * time.Minute)},
+			tail: 5,
+		},
+		{
+			name: "follow",
+			opts: Options{Follow: true},
+			want: &observer.GetFlowsRequest{Follow: true, Number: ^uint64(0)},
+		},
+		{
+			name: "follow with last",
+			opts: Options{Follow: true, Last: 5},
+			want: &observer.GetFlowsRequest{Follow: true, Number: 5},
+		},
+		{
+			name: "follow since",
+			opts: Options{Follow: true, Since: "10m"},
+			want: &observer.GetFlowsRequest{Follow: true, Since: at(10 * time.Minute)},
+		},
+		{
+			name: "follow since with last asks the relay",
+			opts: Options{Follow: true, Since: "10m", Last: 5},
+			want: &observer.GetFlowsRequest{Follow: true, Since: at(10 * time.Minute), Number: 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, tail, err := flowsRequest(tt.opts, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !proto.Equal(req, tt.want) {
+				t.Errorf("got request %v, want %v", req, tt.want)
+			}
+			if tail != tt.tail {
+				t.Errorf("got tail %d, want %d", tail, tt.tail)
+			}
+		})
+	}
+}
+
+func TestFlowsRequestErrors(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"first and last", Options{First: 5, Last: 5}},
+		{"first with follow", Options{First: 5, Follow: true}},
+		{"until with follow", Options{Until: "5m", Follow: true}},
+		{"until before since", Options{Since: "5m", Until: "10m"}},
+		{"invalid since", Options{Since: "yesterday"}},
+		{"invalid until", Options{Until: "tomorrow"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := flowsRequest(tt.opts, now); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
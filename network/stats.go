@@ -0,0 +1,158 @@
+package network
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/accuknox/accuknox-cli/summary"
+	"github.com/cilium/cilium/api/v1/flow"
+	"github.com/cilium/cilium/pkg/identity"
+	api "github.com/cilium/cilium/pkg/monitor/api"
+	"github.com/fatih/color"
+)
+
+// DefaultStatsInterval is the refresh interval of the stats table
+const DefaultStatsInterval = 5 * time.Second
+
+// statsKey groups the flows counted together
+type statsKey struct {
+	source      string
+	destination string
+	verdict     string
+	dropReason  string
+	l7          string
+}
+
+// stats keeps rolling counters of the flows
+type stats struct {
+	started time.Time
+	total   uint64
+	flows   map[statsKey]uint64
+	talkers map[[2]string]uint64
+	drops   map[string]uint64
+	// top is the number of rows of the tables
+	top int
+}
+
+func newStats(top int) *stats {
+	return &stats{
+		started: time.Now(),
+		flows:   map[statsKey]uint64{},
+		talkers: map[[2]string]uint64{},
+		drops:   map[string]uint64{},
+		top:     top,
+	}
+}
+
+// workload names the end of a flow by its pod, its service or its IP address,
+// or its reserved identity when it is outside of the cluster
+func workload(ep *flow.Endpoint, svc *flow.Service, ip string) string {
+	switch {
+	case ep.GetPodName() != "":
+		return path.Join(ep.GetNamespace(), ep.GetPodName())
+	case svc.GetName() != "":
+		return path.Join(svc.GetNamespace(), svc.GetName())
+	}
+	if id := identity.NumericIdentity(ep.GetIdentity()); id.IsReservedIdentity() {
+		if ip == "" {
+			return id.String()
+		}
+		return fmt.Sprintf("%s (%s)", ip, id)
+	}
+	if ip == "" {
+		return "unknown"
+	}
+	return ip
+}
+
+func l7Protocol(f *flow.Flow) string {
+	switch f.GetL7().GetRecord().(type) {
+	case *flow.Layer7_Http:
+		return "http"
+	case *flow.Layer7_Dns:
+		return "dns"
+	case *flow.Layer7_Kafka:
+		return "kafka"
+	}
+	return "-"
+}
+
+func (s *stats) add(f *flow.Flow) {
+	src := workload(f.GetSource(), f.GetSourceService(), f.GetIP().GetSource())
+	dst := workload(f.GetDestination(), f.GetDestinationService(), f.GetIP().GetDestination())
+	if f.GetIsReply().GetValue() {
+		src, dst = dst, src
+	}
+
+	key := statsKey{
+		source:      src,
+		destination: dst,
+		verdict:     f.GetVerdict().String(),
+		dropReason:  "-",
+		l7:          l7Protocol(f),
+	}
+	if f.GetVerdict() == flow.Verdict_DROPPED {
+		key.dropReason = api.DropReason(uint8(f.GetDropReason()))
+		s.drops[key.dropReason]++
+	}
+
+	s.total++
+	s.flows[key]++
+	s.talkers[[2]string{src, dst}]++
+}
+
+// topKeys sorts the keys by decreasing count and keeps the first n
+func topKeys[K comparable](counts map[K]uint64, n int) []K {
+	keys := make([]K, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	if n > 0 && len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+func headerFormatter() summary.Formatter {
+	return color.New(color.Underline).SprintfFunc()
+}
+
+// printTable prints the busiest flows
+func (s *stats) printTable(w io.Writer) {
+	fmt.Fprintf(w, "%d flows in %s\n\n", s.total, time.Since(s.started).Round(time.Second))
+
+	tbl := summary.Heading("SOURCE", "DESTINATION", "VERDICT", "DROP REASON", "L7", "COUNT")
+	tbl.WithHeaderFormatter(headerFormatter()).WithWriter(w)
+	for _, k := range topKeys(s.flows, s.top) {
+		tbl.AddRow(k.source, k.destination, k.verdict, k.dropReason, k.l7, s.flows[k])
+	}
+	tbl.Print()
+}
+
+// printSummary prints the top talkers and the top drop reasons
+func (s *stats) printSummary(w io.Writer) {
+	fmt.Fprintf(w, "\nTop talkers (%d flows in %s):\n\n", s.total, time.Since(s.started).Round(time.Second))
+	tbl := summary.Heading("SOURCE", "DESTINATION", "COUNT")
+	tbl.WithHeaderFormatter(headerFormatter()).WithWriter(w)
+	for _, k := range topKeys(s.talkers, s.top) {
+		tbl.AddRow(k[0], k[1], s.talkers[k])
+	}
+	tbl.Print()
+
+	fmt.Fprintf(w, "\nTop drop reasons:\n\n")
+	tbl = summary.Heading("DROP REASON", "COUNT")
+	tbl.WithHeaderFormatter(headerFormatter()).WithWriter(w)
+	for _, k := range topKeys(s.drops, s.top) {
+		tbl.AddRow(k, s.drops[k])
+	}
+	tbl.Print()
+}
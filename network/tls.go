@@ -0,0 +1,59 @@
+package network
+
+import (
+	"context"
+	"strings"
+
+	"github.com/accuknox/accuknox-cli/grpcutil"
+	"github.com/kubearmor/kubearmor-client/k8s"
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultRelayServerName matches the wildcard certificate Cilium generates for
+// hubble-relay (*.hubble-relay.cilium.io). It is used when connecting through a
+// port-forward, where the address does not name the relay.
+const DefaultRelayServerName = "relay.hubble-relay.cilium.io"
+
+// TLSSecretName is the secret holding the client certificate of hubble-relay
+// and its CA, in the namespace of hubble-relay
+const TLSSecretName = "hubble-relay-client-certs"
+
+// LoadTLSSecret loads the CA and the client certificate from a secret given as
+// [namespace/]name. Certificates given as files take precedence.
+func (o *Options) LoadTLSSecret(c *k8s.Client, ref string) error {
+	namespace, name := "kube-system", ref
+	if i := strings.Index(ref, "/"); i >= 0 {
+		namespace, name = ref[:i], ref[i+1:]
+	}
+
+	secret, err := c.K8sClientset.CoreV1().Secrets(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if o.TLSCACert == "" {
+		o.tlsCA = secret.Data["ca.crt"]
+	}
+	if o.TLSClientCert == "" && o.TLSClientKey == "" {
+		o.tlsCert = secret.Data[corev1.TLSCertKey]
+		o.tlsKey = secret.Data[corev1.TLSPrivateKeyKey]
+	}
+	return nil
+}
+
+// transportCredentials returns the credentials of the connection to
+// hubble-relay, with a client certificate for mTLS when one is given
+func transportCredentials(o Options) (grpc.DialOption, error) {
+	return grpcutil.Credentials(grpcutil.TLS{
+		Enabled:        o.TLS,
+		ServerName:     o.TLSServerName,
+		CACertFile:     o.TLSCACert,
+		ClientCertFile: o.TLSClientCert,
+		ClientKeyFile:  o.TLSClientKey,
+		CACert:         o.tlsCA,
+		ClientCert:     o.tlsCert,
+		ClientKey:      o.tlsKey,
+	})
+}
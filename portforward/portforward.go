@@ -0,0 +1,311 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kubearmor/kubearmor-client/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	pf "k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// Options Structure
+type Options struct {
+	Namespace  string
+	Service    string
+	LocalPort  int
+	RemotePort int
+	Addresses  []string
+	Out        io.Writer
+	ErrOut     io.Writer
+}
+
+// Tunnel is an established port-forward to a single pod
+type Tunnel struct {
+	Pod       string
+	LocalPort int
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+	doneChan chan error
+}
+
+// DetectNamespace returns the namespace of the deployments matching the label
+// selector, or "" when there is none
+func DetectNamespace(c *k8s.Client, selector string) (string, error) {
+	list, err := c.K8sClientset.AppsV1().Deployments("").List(context.Background(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return "", err
+	}
+
+	found := map[string]bool{}
+	var namespaces []string
+	for _, d := range list.Items {
+		if !found[d.Namespace] {
+			found[d.Namespace] = true
+			namespaces = append(namespaces, d.Namespace)
+		}
+	}
+	switch len(namespaces) {
+	case 0:
+		return "", nil
+	case 1:
+		return namespaces[0], nil
+	default:
+		sort.Strings(namespaces)
+		return "", fmt.Errorf("deployments matching %s found in several namespaces (%s), select one with the namespace flag", selector, strings.Join(namespaces, ", "))
+	}
+}
+
+// ErrNoReadyPod is returned when no ready pod backs the requested service
+var ErrNoReadyPod = errors.New("no ready pod found")
+
+// SelectPod picks a running and ready pod behind the service and resolves the
+// container port that service port remotePort maps to.
+func SelectPod(c *k8s.Client, namespace, service string, remotePort int) (string, int, error) {
+	svc, err := c.K8sClientset.CoreV1().Services(namespace).Get(context.Background(), service, metav1.GetOptions{})
+	if err != nil {
+		return "", 0, err
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return "", 0, fmt.Errorf("service %s/%s has no pod selector", namespace, service)
+	}
+
+	var svcPort *corev1.ServicePort
+	for i, p := range svc.Spec.Ports {
+		if int(p.Port) == remotePort {
+			svcPort = &svc.Spec.Ports[i]
+			break
+		}
+	}
+	if svcPort == nil {
+		return "", 0, fmt.Errorf("service %s/%s does not expose port %d", namespace, service, remotePort)
+	}
+
+	pods, err := c.K8sClientset.CoreV1().Pods(namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil || !isPodReady(&pod) {
+			continue
+		}
+		port, err := containerPort(&pod, svcPort)
+		if err != nil {
+			return "", 0, err
+		}
+		return pod.Name, port, nil
+	}
+
+	return "", 0, fmt.Errorf("%w for service %s/%s", ErrNoReadyPod, namespace, service)
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func containerPort(pod *corev1.Pod, svcPort *corev1.ServicePort) (int, error) {
+	switch svcPort.TargetPort.Type {
+	case intstr.Int:
+		if svcPort.TargetPort.IntVal == 0 {
+			return int(svcPort.Port), nil
+		}
+		return int(svcPort.TargetPort.IntVal), nil
+	default:
+		name := svcPort.TargetPort.StrVal
+		for _, container := range pod.Spec.Containers {
+			for _, p := range container.Ports {
+				if p.Name == name {
+					return int(p.ContainerPort), nil
+				}
+			}
+		}
+		return 0, fmt.Errorf("pod %s has no container port named %q", pod.Name, name)
+	}
+}
+
+// Open selects a pod behind the service and forwards a local port to it. It
+// returns once the local listeners are ready.
+func Open(c *k8s.Client, o Options) (*Tunnel, error) {
+	pod, port, err := SelectPod(c, o.Namespace, o.Service, o.RemotePort)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, upgrader, err := spdy.RoundTripperFor(c.Config)
+	if err != nil {
+		return nil, err
+	}
+	url := c.K8sClientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(o.Namespace).
+		Name(pod).
+		SubResource("portforward").
+		URL()
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+
+	addresses := o.Addresses
+	if len(addresses) == 0 {
+		addresses = []string{"localhost"}
+	}
+
+	t := &Tunnel{
+		Pod:      pod,
+		stopChan: make(chan struct{}),
+		doneChan: make(chan error, 1),
+	}
+	readyChan := make(chan struct{})
+
+	fw, err := pf.NewOnAddresses(dialer, addresses, []string{fmt.Sprintf("%d:%d", o.LocalPort, port)}, t.stopChan, readyChan, o.Out, o.ErrOut)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		t.doneChan <- fw.ForwardPorts()
+		close(t.doneChan)
+	}()
+
+	select {
+	case <-readyChan:
+	case err := <-t.doneChan:
+		if err == nil {
+			err = fmt.Errorf("port-forward to %s/%s closed before becoming ready", o.Namespace, pod)
+		}
+		return nil, err
+	}
+
+	ports, err := fw.GetPorts()
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	t.LocalPort = int(ports[0].Local)
+
+	return t, nil
+}
+
+// Done yields the forwarding result and is closed once the tunnel stops,
+// either on Close or because the connection to the pod was lost.
+func (t *Tunnel) Done() <-chan error {
+	return t.doneChan
+}
+
+// Close stops forwarding and waits for the listeners to shut down
+func (t *Tunnel) Close() {
+	t.stopOnce.Do(func() {
+		close(t.stopChan)
+	})
+	for range t.doneChan {
+	}
+}
+
+// IsReachable reports whether a TCP connection to addr can be established
+func IsReachable(addr string) bool {
+	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
+
+// EnsureTunnel returns addr unchanged if it is reachable. Otherwise it opens a
+// tunnel to the service on a random local port and returns the local address
+// together with the tunnel, which the caller must close when done.
+func EnsureTunnel(c *k8s.Client, addr string, o Options) (string, *Tunnel, error) {
+	if IsReachable(addr) {
+		return addr, nil, nil
+	}
+
+	o.LocalPort = 0
+	o.Addresses = []string{"localhost"}
+	t, err := Open(c, o)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s is unreachable and port-forward to service/%s failed: %w", addr, o.Service, err)
+	}
+
+	return net.JoinHostPort("localhost", strconv.Itoa(t.LocalPort)), t, nil
+}
+
+const maxReconnectBackoff = 30 * time.Second
+
+// Supervise keeps a tunnel to the service open until stopChan is closed. When
+// the connection to the current pod is lost, for example because the pod was
+// restarted, it selects a ready pod again and reconnects. Only a failure of
+// the first attempt is returned.
+func Supervise(c *k8s.Client, o Options, stopChan <-chan struct{}) error {
+	t, err := Open(c, o)
+	if err != nil {
+		return err
+	}
+	o.printf("service/%s: connected to pod %s/%s\n", o.Service, o.Namespace, t.Pod)
+
+	for {
+		select {
+		case <-stopChan:
+			t.Close()
+			return nil
+		case <-t.Done():
+		}
+
+		o.printf("service/%s: lost connection to pod %s/%s, reconnecting...\n", o.Service, o.Namespace, t.Pod)
+		if t = reconnect(c, o, stopChan); t == nil {
+			return nil
+		}
+		o.printf("service/%s: reconnected to pod %s/%s\n", o.Service, o.Namespace, t.Pod)
+	}
+}
+
+func reconnect(c *k8s.Client, o Options, stopChan <-chan struct{}) *Tunnel {
+	backoff := time.Second
+	for {
+		select {
+		case <-stopChan:
+			return nil
+		case <-time.After(backoff):
+		}
+
+		t, err := Open(c, o)
+		if err == nil {
+			return t
+		}
+
+		if backoff *= 2; backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+		if o.ErrOut != nil {
+			fmt.Fprintf(o.ErrOut, "service/%s: %s, retrying in %s\n", o.Service, err.Error(), backoff)
+		}
+	}
+}
+
+func (o Options) printf(format string, a ...interface{}) {
+	if o.Out != nil {
+		fmt.Fprintf(o.Out, format, a...)
+	}
+}
@@ -0,0 +1,411 @@
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/accuknox/accuknox-cli/summary"
+	"github.com/fatih/color"
+	"github.com/kubearmor/kubearmor-client/k8s"
+	"golang.org/x/exp/slices"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Options Structure
+type Options struct {
+	// Namespaces the components are installed in
+	CiliumNamespace          string
+	KubeArmorNamespace       string
+	DiscoveryEngineNamespace string
+
+	Cilium          bool
+	KubeArmor       bool
+	DiscoveryEngine bool
+}
+
+// Result of a single check
+type Result string
+
+const (
+	// Pass means the check succeeded
+	Pass Result = "PASS"
+	// Warn means the install can go ahead but may not work as expected
+	Warn Result = "WARN"
+	// Fail means the install should not go ahead
+	Fail Result = "FAIL"
+)
+
+// Check is the outcome of one preflight check
+type Check struct {
+	Name    string
+	Result  Result
+	Message string
+}
+
+// Report holds the outcome of all preflight checks
+type Report struct {
+	Checks []Check
+}
+
+func (r *Report) add(name string, result Result, format string, a ...interface{}) {
+	r.Checks = append(r.Checks, Check{Name: name, Result: result, Message: fmt.Sprintf(format, a...)})
+}
+
+// Failed reports whether any check failed
+func (r *Report) Failed() bool {
+	for _, c := range r.Checks {
+		if c.Result == Fail {
+			return true
+		}
+	}
+	return false
+}
+
+// Warned reports whether any check warned
+func (r *Report) Warned() bool {
+	for _, c := range r.Checks {
+		if c.Result == Warn {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// minK8sVersion is the oldest Kubernetes version the stack supports
+	minK8sVersion = []int{1, 16}
+	// minCiliumKernel is the oldest kernel Cilium runs on
+	minCiliumKernel = []int{4, 9, 17}
+	// minBTFKernel is the oldest kernel shipping BTF type information
+	minBTFKernel = []int{5, 2}
+	// minBPFLSMKernel is the oldest kernel with BPF-LSM support
+	minBPFLSMKernel = []int{5, 7}
+
+	// knownCNIs maps kube-system daemonsets to the CNI they belong to
+	knownCNIs = map[string]string{
+		"calico-node":     "Calico",
+		"canal":           "Canal",
+		"kube-flannel-ds": "Flannel",
+		"weave-net":       "Weave Net",
+		"aws-node":        "AWS VPC CNI",
+		"kube-router":     "kube-router",
+		"antrea-agent":    "Antrea",
+	}
+)
+
+// Run executes every preflight check without modifying the cluster
+func Run(c *k8s.Client, o Options) *Report {
+	r := &Report{}
+
+	checkKubeConfig(r)
+	checkK8sVersion(c, r)
+	checkNodes(c, o, r)
+	if o.Cilium {
+		checkCNI(c, r)
+	}
+	checkRBAC(c, o, r)
+	checkExisting(c, o, r)
+
+	return r
+}
+
+func checkKubeConfig(r *Report) {
+	const name = "kubeconfig"
+
+	paths := clientcmd.NewDefaultClientConfigLoadingRules().Precedence
+	for _, p := range paths {
+		if _, err := os.Stat(p); err == nil {
+			r.add(name, Pass, "found %s", p)
+			return
+		}
+	}
+
+	r.add(name, Fail, "no kubeconfig found in %s", strings.Join(paths, ", "))
+}
+
+func checkK8sVersion(c *k8s.Client, r *Report) {
+	const name = "kubernetes-version"
+
+	info, err := c.K8sClientset.Discovery().ServerVersion()
+	if err != nil {
+		r.add(name, Fail, "unable to get server version: %s", err.Error())
+		return
+	}
+
+	if !versionAtLeast(info.GitVersion, minK8sVersion) {
+		r.add(name, Fail, "%s is older than the minimum supported %s", info.GitVersion, formatVersion(minK8sVersion))
+		return
+	}
+	r.add(name, Pass, "%s", info.GitVersion)
+}
+
+func checkNodes(c *k8s.Client, o Options, r *Report) {
+	nodes, err := c.K8sClientset.CoreV1().Nodes().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		r.add("nodes", Fail, "unable to list nodes: %s", err.Error())
+		return
+	}
+	if len(nodes.Items) == 0 {
+		r.add("nodes", Fail, "no nodes found")
+		return
+	}
+
+	for _, node := range nodes.Items {
+		kernel := node.Status.NodeInfo.KernelVersion
+		name := "node/" + node.Name
+
+		if o.Cilium && !versionAtLeast(kernel, minCiliumKernel) {
+			r.add(name, Fail, "kernel %s is older than %s required by Cilium", kernel, formatVersion(minCiliumKernel))
+			continue
+		}
+
+		// BTF and BPF-LSM can be backported or left out of the kernel build,
+		// they are only guessed from the kernel version
+		if o.KubeArmor {
+			if !versionAtLeast(kernel, minBTFKernel) {
+				r.add(name, Warn, "kernel %s is older than %s and may lack BTF (guessed from the kernel version), KubeArmor then needs kernel headers on the node",
+					kernel, formatVersion(minBTFKernel))
+				continue
+			}
+			if !versionAtLeast(kernel, minBPFLSMKernel) {
+				r.add(name, Warn, "kernel %s is older than %s and may lack BPF-LSM (guessed from the kernel version), KubeArmor enforcement then relies on AppArmor or SELinux (%s)",
+					kernel, formatVersion(minBPFLSMKernel), node.Status.NodeInfo.OSImage)
+				continue
+			}
+		}
+
+		r.add(name, Pass, "kernel %s, %s", kernel, node.Status.NodeInfo.OSImage)
+	}
+}
+
+func checkCNI(c *k8s.Client, r *Report) {
+	const name = "existing-cni"
+
+	daemonsets, err := c.K8sClientset.AppsV1().DaemonSets("kube-system").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		r.add(name, Warn, "unable to list daemonsets: %s", err.Error())
+		return
+	}
+
+	var found []string
+	for _, ds := range daemonsets.Items {
+		if cni, ok := knownCNIs[ds.Name]; ok {
+			found = append(found, cni)
+		}
+	}
+	if len(found) > 0 {
+		r.add(name, Warn, "%s already installed, it may conflict with Cilium", strings.Join(found, ", "))
+		return
+	}
+	r.add(name, Pass, "no other CNI detected")
+}
+
+type permission struct {
+	group    string
+	resource string
+	verb     string
+	// namespace is empty for cluster-scoped resources
+	namespace string
+}
+
+func (p permission) String() string {
+	if p.namespace == "" {
+		return p.verb + " " + p.resource
+	}
+	return fmt.Sprintf("%s %s in %s", p.verb, p.resource, p.namespace)
+}
+
+// clusterScoped lists the resources whose access is reviewed without a
+// namespace
+var clusterScoped = map[string]bool{
+	"namespaces":                    true,
+	"clusterroles":                  true,
+	"clusterrolebindings":           true,
+	"customresourcedefinitions":     true,
+	"mutatingwebhookconfigurations": true,
+}
+
+// permissions lists the permissions the install of the enabled components
+// requires, the namespaced ones in the namespace of each component
+func permissions(o Options) []permission {
+	var out []permission
+	add := func(namespace string, ps ...permission) {
+		for _, p := range ps {
+			if !clusterScoped[p.resource] {
+				p.namespace = namespace
+			}
+			if !slices.Contains(out, p) {
+				out = append(out, p)
+			}
+		}
+	}
+
+	add("", permission{group: "", resource: "namespaces", verb: "create"})
+	if o.Cilium {
+		add(o.CiliumNamespace,
+			permission{group: "", resource: "services", verb: "create"},
+			permission{group: "", resource: "serviceaccounts", verb: "create"},
+			permission{group: "", resource: "configmaps", verb: "create"},
+			permission{group: "", resource: "secrets", verb: "create"},
+			permission{group: "apps", resource: "deployments", verb: "create"},
+			permission{group: "apps", resource: "daemonsets", verb: "create"},
+			permission{group: "rbac.authorization.k8s.io", resource: "clusterroles", verb: "create"},
+			permission{group: "rbac.authorization.k8s.io", resource: "clusterrolebindings", verb: "create"},
+		)
+	}
+	if o.KubeArmor {
+		add(o.KubeArmorNamespace,
+			permission{group: "", resource: "services", verb: "create"},
+			permission{group: "", resource: "serviceaccounts", verb: "create"},
+			permission{group: "", resource: "secrets", verb: "create"},
+			permission{group: "apps", resource: "deployments", verb: "create"},
+			permission{group: "apps", resource: "daemonsets", verb: "create"},
+			permission{group: "rbac.authorization.k8s.io", resource: "clusterrolebindings", verb: "create"},
+			permission{group: "apiextensions.k8s.io", resource: "customresourcedefinitions", verb: "create"},
+			permission{group: "admissionregistration.k8s.io", resource: "mutatingwebhookconfigurations", verb: "create"},
+		)
+	}
+	if o.DiscoveryEngine {
+		// drifted discovery-engine resources are updated on re-install
+		add(o.DiscoveryEngineNamespace,
+			permission{group: "", resource: "services", verb: "create"},
+			permission{group: "", resource: "serviceaccounts", verb: "create"},
+			permission{group: "", resource: "configmaps", verb: "create"},
+			permission{group: "apps", resource: "deployments", verb: "create"},
+			permission{group: "rbac.authorization.k8s.io", resource: "clusterrolebindings", verb: "create"},
+			permission{group: "", resource: "services", verb: "update"},
+			permission{group: "", resource: "configmaps", verb: "update"},
+			permission{group: "apps", resource: "deployments", verb: "update"},
+			permission{group: "rbac.authorization.k8s.io", resource: "clusterrolebindings", verb: "update"},
+		)
+	}
+	return out
+}
+
+func checkRBAC(c *k8s.Client, o Options, r *Report) {
+	const name = "rbac"
+
+	var denied []string
+	for _, p := range permissions(o) {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: p.namespace,
+					Group:     p.group,
+					Resource:  p.resource,
+					Verb:      p.verb,
+				},
+			},
+		}
+		res, err := c.K8sClientset.AuthorizationV1().SelfSubjectAccessReviews().Create(context.Background(), review, metav1.CreateOptions{})
+		if err != nil {
+			r.add(name, Fail, "unable to review access: %s", err.Error())
+			return
+		}
+		if !res.Status.Allowed {
+			denied = append(denied, p.String())
+		}
+	}
+
+	if len(denied) > 0 {
+		r.add(name, Fail, "not allowed to %s", strings.Join(denied, ", "))
+		return
+	}
+	r.add(name, Pass, "all required permissions granted")
+}
+
+func checkExisting(c *k8s.Client, o Options, r *Report) {
+	existing := []struct {
+		enabled   bool
+		name      string
+		namespace string
+		kind      string
+		workload  string
+	}{
+		{o.Cilium, "cilium", o.CiliumNamespace, "DaemonSet", "cilium"},
+		{o.KubeArmor, "kubearmor", o.KubeArmorNamespace, "DaemonSet", "kubearmor"},
+		{o.DiscoveryEngine, "discoveryengine", o.DiscoveryEngineNamespace, "Deployment", "knoxautopolicy"},
+	}
+
+	for _, e := range existing {
+		if !e.enabled {
+			continue
+		}
+		name := "existing-" + e.name
+		var err error
+		if e.kind == "DaemonSet" {
+			_, err = c.K8sClientset.AppsV1().DaemonSets(e.namespace).Get(context.Background(), e.workload, metav1.GetOptions{})
+		} else {
+			_, err = c.K8sClientset.AppsV1().Deployments(e.namespace).Get(context.Background(), e.workload, metav1.GetOptions{})
+		}
+		switch {
+		case err == nil:
+			r.add(name, Warn, "%s is already installed in %s", e.name, e.namespace)
+		case k8serrors.IsNotFound(err):
+			r.add(name, Pass, "%s is not installed", e.name)
+		default:
+			r.add(name, Warn, "unable to check for %s: %s", e.name, err.Error())
+		}
+	}
+}
+
+// parseVersion extracts the leading numeric components of versions such as
+// "v1.22.3-gke.100" or "5.4.0-1049-aws"
+func parseVersion(v string) []int {
+	v = strings.TrimPrefix(v, "v")
+	var out []int
+	for _, part := range strings.Split(v, ".") {
+		end := 0
+		for end < len(part) && part[end] >= '0' && part[end] <= '9' {
+			end++
+		}
+		n, err := strconv.Atoi(part[:end])
+		if err != nil {
+			break
+		}
+		out = append(out, n)
+		if end != len(part) {
+			break
+		}
+	}
+	return out
+}
+
+func versionAtLeast(v string, min []int) bool {
+	parsed := parseVersion(v)
+	for i, m := range min {
+		n := 0
+		if i < len(parsed) {
+			n = parsed[i]
+		}
+		if n != m {
+			return n > m
+		}
+	}
+	return true
+}
+
+func formatVersion(v []int) string {
+	parts := make([]string, len(v))
+	for i, n := range v {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Print renders the report as a table
+func (r *Report) Print() {
+	headerFmt := color.New(color.Underline).SprintfFunc()
+	tbl := summary.Heading("CHECK", "RESULT", "MESSAGE")
+	tbl.WithHeaderFormatter(headerFmt)
+	for _, c := range r.Checks {
+		tbl.AddRow(c.Name, c.Result, c.Message)
+	}
+	tbl.Print()
+}
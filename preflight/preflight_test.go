@@ -0,0 +1,58 @@
+package preflight
+
+import (
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    []int
+	}{
+		{"v1.22.3", []int{1, 22, 3}},
+		{"v1.22.3-gke.100", []int{1, 22, 3}},
+		{"v1.21.5+k3s1", []int{1, 21, 5}},
+		{"5.4.0-1049-aws", []int{5, 4, 0}},
+		{"4.18.0-305.el8.x86_64", []int{4, 18, 0}},
+		{"5.10.102.1-microsoft-standard-WSL2", []int{5, 10, 102, 1}},
+		{"6.1", []int{6, 1}},
+		{"", nil},
+		{"unknown", nil},
+	}
+
+	for _, tt := range tests {
+		if got := parseVersion(tt.version); !slices.Equal(got, tt.want) {
+			t.Errorf("parseVersion(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		version string
+		min     []int
+		want    bool
+	}{
+		{"v1.22.3", minK8sVersion, true},
+		{"v1.16.0", minK8sVersion, true},
+		{"v1.15.12", minK8sVersion, false},
+		{"v2.0.0", minK8sVersion, true},
+		{"4.9.17-generic", minCiliumKernel, true},
+		{"4.9.16", minCiliumKernel, false},
+		{"4.9", minCiliumKernel, false},
+		{"4.19.0", minCiliumKernel, true},
+		{"5.4.0-1049-aws", minBTFKernel, true},
+		{"5.4.0-1049-aws", minBPFLSMKernel, false},
+		{"4.18.0-305.el8.x86_64", minBTFKernel, false},
+		{"5.7", minBPFLSMKernel, true},
+		{"", minK8sVersion, false},
+	}
+
+	for _, tt := range tests {
+		if got := versionAtLeast(tt.version, tt.min); got != tt.want {
+			t.Errorf("versionAtLeast(%q, %v) = %v, want %v", tt.version, tt.min, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	di "github.com/accuknox/accuknox-cli/install"
+	"golang.org/x/exp/slices"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion is the only profile schema version understood by this release
+	APIVersion = "accuknox.com/v1alpha1"
+	// Kind of an install profile document
+	Kind = "InstallProfile"
+)
+
+// Profile describes the settings of every component installed by
+// `accuknox install`. It can be written in YAML or JSON.
+type Profile struct {
+	APIVersion      string          `json:"apiVersion"`
+	Kind            string          `json:"kind"`
+	Cilium          Cilium          `json:"cilium"`
+	KubeArmor       KubeArmor       `json:"kubearmor"`
+	DiscoveryEngine DiscoveryEngine `json:"discoveryEngine"`
+}
+
+// Cilium settings
+type Cilium struct {
+	Enabled              *bool  `json:"enabled,omitempty"`
+	Namespace            string `json:"namespace,omitempty"`
+	Version              string `json:"version,omitempty"`
+	AgentImage           string `json:"agentImage,omitempty"`
+	OperatorImage        string `json:"operatorImage,omitempty"`
+	ClusterName          string `json:"clusterName,omitempty"`
+	ClusterID            int    `json:"clusterID,omitempty"`
+	Encryption           string `json:"encryption,omitempty"`
+	NodeEncryption       bool   `json:"nodeEncryption,omitempty"`
+	Wait                 *bool  `json:"wait,omitempty"`
+	WaitDuration         string `json:"waitDuration,omitempty"`
+	RestartUnmanagedPods *bool  `json:"restartUnmanagedPods,omitempty"`
+	CiliumReadyTimeout   string `json:"ciliumReadyTimeout,omitempty"`
+	Rollback             *bool  `json:"rollback,omitempty"`
+	HelmValuesSecretName string `json:"helmValuesSecretName,omitempty"`
+	Hubble               Hubble `json:"hubble"`
+}
+
+// Hubble settings, hubble relay is always enabled
+type Hubble struct {
+	RelayImage string `json:"relayImage,omitempty"`
+}
+
+// KubeArmor settings
+type KubeArmor struct {
+	Enabled   *bool  `json:"enabled,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Image     string `json:"image,omitempty"`
+	Audit     string `json:"audit,omitempty"`
+}
+
+// DiscoveryEngine settings, values set in Config override the default
+// discovery-engine configuration
+type DiscoveryEngine struct {
+	Enabled   *bool      `json:"enabled,omitempty"`
+	Namespace string     `json:"namespace,omitempty"`
+	Image     string     `json:"image,omitempty"`
+	Config    *di.Config `json:"config,omitempty"`
+}
+
+var (
+	// encryptionModes accepted by Cilium
+	encryptionModes = []string{"disabled", "ipsec", "wireguard"}
+	// auditContexts accepted by KubeArmor
+	auditContexts = []string{"all", "file", "network", "capabilities"}
+)
+
+const (
+	// maxClusterID is the largest cluster ID accepted by Cilium cluster mesh
+	maxClusterID = 255
+)
+
+// Load reads and validates the profile at path. Unknown fields are rejected so
+// that typos do not silently fall back to defaults.
+func Load(path string) (*Profile, error) {
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse decodes and validates a YAML or JSON profile
+func Parse(b []byte) (*Profile, error) {
+	// the config is decoded onto the defaults so that a profile only has to
+	// list the values it changes
+	c := di.DefaultConfig()
+	p := &Profile{DiscoveryEngine: DiscoveryEngine{Config: &c}}
+	if err := yaml.UnmarshalStrict(b, p); err != nil {
+		return nil, fmt.Errorf("invalid profile: %w", err)
+	}
+	if err := p.Validate().ToAggregate(); err != nil {
+		return nil, fmt.Errorf("invalid profile: %w", err)
+	}
+	return p, nil
+}
+
+// Validate checks every field of the profile
+func (p *Profile) Validate() field.ErrorList {
+	var errs field.ErrorList
+
+	if p.APIVersion != APIVersion {
+		errs = append(errs, field.NotSupported(field.NewPath("apiVersion"), p.APIVersion, []string{APIVersion}))
+	}
+	if p.Kind != Kind {
+		errs = append(errs, field.NotSupported(field.NewPath("kind"), p.Kind, []string{Kind}))
+	}
+
+	errs = append(errs, p.Cilium.validate(field.NewPath("cilium"))...)
+	errs = append(errs, p.KubeArmor.validate(field.NewPath("kubearmor"))...)
+	errs = append(errs, p.DiscoveryEngine.validate(field.NewPath("discoveryEngine"))...)
+
+	return errs
+}
+
+func (c *Cilium) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	errs = append(errs, validateNamespace(c.Namespace, path.Child("namespace"))...)
+	if c.ClusterID < 0 || c.ClusterID > maxClusterID {
+		errs = append(errs, field.Invalid(path.Child("clusterID"), c.ClusterID, fmt.Sprintf("must be between 0 and %d", maxClusterID)))
+	}
+	if c.Encryption != "" && !slices.Contains(encryptionModes, c.Encryption) {
+		errs = append(errs, field.NotSupported(path.Child("encryption"), c.Encryption, encryptionModes))
+	}
+	errs = append(errs, validateDuration(c.WaitDuration, path.Child("waitDuration"))...)
+	errs = append(errs, validateDuration(c.CiliumReadyTimeout, path.Child("ciliumReadyTimeout"))...)
+	if c.HelmValuesSecretName != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(c.HelmValuesSecretName) {
+			errs = append(errs, field.Invalid(path.Child("helmValuesSecretName"), c.HelmValuesSecretName, msg))
+		}
+	}
+
+	return errs
+}
+
+// ValidateEncryption checks the encryption settings of Cilium. They are only
+// checked once the profile is merged with the flags, since --encryption may
+// enable the encryption nodeEncryption requires.
+func ValidateEncryption(encryption string, nodeEncryption bool) field.ErrorList {
+	var errs field.ErrorList
+	if nodeEncryption && (encryption == "" || encryption == "disabled") {
+		errs = append(errs, field.Invalid(field.NewPath("cilium", "nodeEncryption"), nodeEncryption, "requires encryption to be ipsec or wireguard"))
+	}
+	return errs
+}
+
+func (k *KubeArmor) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	errs = append(errs, validateNamespace(k.Namespace, path.Child("namespace"))...)
+	if k.Audit != "" {
+		for _, a := range strings.Split(k.Audit, ",") {
+			if !slices.Contains(auditContexts, a) {
+				errs = append(errs, field.NotSupported(path.Child("audit"), a, auditContexts))
+			}
+		}
+	}
+
+	return errs
+}
+
+func (d *DiscoveryEngine) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	errs = append(errs, validateNamespace(d.Namespace, path.Child("namespace"))...)
+	if d.Config != nil {
+		errs = append(errs, d.Config.Validate(path.Child("config"))...)
+	}
+
+	return errs
+}
+
+func validateNamespace(ns string, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if ns == "" {
+		return errs
+	}
+	for _, msg := range validation.IsDNS1123Label(ns) {
+		errs = append(errs, field.Invalid(path, ns, msg))
+	}
+	return errs
+}
+
+func validateDuration(d string, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if d == "" {
+		return errs
+	}
+	if v, err := time.ParseDuration(d); err != nil {
+		errs = append(errs, field.Invalid(path, d, "must be a duration such as 30s or 5m"))
+	} else if v < 0 {
+		errs = append(errs, field.Invalid(path, d, "must not be negative"))
+	}
+	return errs
+}
+
+// Duration returns the parsed duration, Validate has already rejected
+// malformed values
+func Duration(d string) time.Duration {
+	v, _ := time.ParseDuration(d)
+	return v
+}
+
+// IsEnabled reports whether a component is enabled, components are enabled
+// unless explicitly disabled
+func IsEnabled(enabled *bool) bool {
+	return enabled == nil || *enabled
+}
@@ -0,0 +1,302 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/accuknox/accuknox-cli/summary"
+	"github.com/fatih/color"
+	"github.com/kubearmor/kubearmor-client/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Options Structure
+type Options struct {
+	Namespace                string
+	DiscoveryEngineNamespace string
+	Output                   string
+	Wait                     bool
+	WaitDuration             time.Duration
+}
+
+// Workload holds the health of one component workload
+type Workload struct {
+	Component string   `json:"component"`
+	Kind      string   `json:"kind"`
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Installed bool     `json:"installed"`
+	Desired   int32    `json:"desired"`
+	Ready     int32    `json:"ready"`
+	Available int32    `json:"available"`
+	Restarts  int32    `json:"restarts"`
+	Images    []string `json:"images,omitempty"`
+	Events    []string `json:"events,omitempty"`
+}
+
+// Healthy reports whether every desired replica is ready and available. A
+// deployment scaled down to zero is healthy, a daemonset scheduled on no node
+// is not.
+func (w Workload) Healthy() bool {
+	if !w.Installed || (w.Desired == 0 && w.Kind != kindDeployment) {
+		return false
+	}
+	return w.Ready == w.Desired && w.Available == w.Desired
+}
+
+// Report is the health of all workloads
+type Report struct {
+	Healthy   bool       `json:"healthy"`
+	Workloads []Workload `json:"workloads"`
+}
+
+const (
+	kindDaemonSet  = "DaemonSet"
+	kindDeployment = "Deployment"
+
+	// eventWindow bounds how old a warning event may be to be reported
+	eventWindow = time.Hour
+	// maxEvents is the number of warning events reported per workload
+	maxEvents = 3
+)
+
+func targets(o Options) []Workload {
+	return []Workload{
+		{Component: "cilium", Kind: kindDaemonSet, Namespace: o.Namespace, Name: "cilium"},
+		{Component: "cilium", Kind: kindDeployment, Namespace: o.Namespace, Name: "cilium-operator"},
+		{Component: "cilium", Kind: kindDeployment, Namespace: o.Namespace, Name: "hubble-relay"},
+		{Component: "kubearmor", Kind: kindDaemonSet, Namespace: o.Namespace, Name: "kubearmor"},
+		{Component: "kubearmor", Kind: kindDeployment, Namespace: o.Namespace, Name: "kubearmor-relay"},
+		{Component: "discovery-engine", Kind: kindDeployment, Namespace: o.DiscoveryEngineNamespace, Name: "knoxautopolicy"},
+	}
+}
+
+// GetStatus inspects every component workload
+func GetStatus(c *k8s.Client, o Options) (*Report, error) {
+	report := &Report{}
+	events := map[string][]corev1.Event{}
+	installed := 0
+	healthy := 0
+
+	for _, w := range targets(o) {
+		selector, err := inspect(c, &w)
+		if err != nil {
+			return nil, err
+		}
+
+		if w.Installed {
+			installed++
+
+			pods, err := c.K8sClientset.CoreV1().Pods(w.Namespace).List(context.Background(), metav1.ListOptions{
+				LabelSelector: metav1.FormatLabelSelector(selector),
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			names := map[string]bool{w.Name: true}
+			for _, pod := range pods.Items {
+				names[pod.Name] = true
+				for _, cs := range pod.Status.ContainerStatuses {
+					w.Restarts += cs.RestartCount
+				}
+			}
+
+			if _, ok := events[w.Namespace]; !ok {
+				list, err := c.K8sClientset.CoreV1().Events(w.Namespace).List(context.Background(), metav1.ListOptions{
+					FieldSelector: "type=" + corev1.EventTypeWarning,
+				})
+				if err != nil {
+					return nil, err
+				}
+				events[w.Namespace] = list.Items
+			}
+			w.Events = recentEvents(events[w.Namespace], names)
+
+			if w.Healthy() {
+				healthy++
+			}
+		}
+
+		report.Workloads = append(report.Workloads, w)
+	}
+
+	report.Healthy = installed > 0 && healthy == installed
+	return report, nil
+}
+
+// inspect fills the replica counts and images of the workload and returns its
+// pod selector
+func inspect(c *k8s.Client, w *Workload) (*metav1.LabelSelector, error) {
+	var spec corev1.PodSpec
+	var selector *metav1.LabelSelector
+
+	switch w.Kind {
+	case kindDaemonSet:
+		ds, err := c.K8sClientset.AppsV1().DaemonSets(w.Namespace).Get(context.Background(), w.Name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		w.Desired = ds.Status.DesiredNumberScheduled
+		w.Ready = ds.Status.NumberReady
+		w.Available = ds.Status.NumberAvailable
+		spec, selector = ds.Spec.Template.Spec, ds.Spec.Selector
+
+	case kindDeployment:
+		d, err := c.K8sClientset.AppsV1().Deployments(w.Namespace).Get(context.Background(), w.Name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		w.Desired = deploymentReplicas(d)
+		w.Ready = d.Status.ReadyReplicas
+		w.Available = d.Status.AvailableReplicas
+		spec, selector = d.Spec.Template.Spec, d.Spec.Selector
+	}
+
+	w.Installed = true
+	for _, container := range spec.Containers {
+		w.Images = append(w.Images, container.Image)
+	}
+
+	return selector, nil
+}
+
+func deploymentReplicas(d *appsv1.Deployment) int32 {
+	if d.Spec.Replicas == nil {
+		return 1
+	}
+	return *d.Spec.Replicas
+}
+
+// recentEvents returns the latest warning events involving one of the names
+func recentEvents(events []corev1.Event, names map[string]bool) []string {
+	var matched []corev1.Event
+	for _, e := range events {
+		if !names[e.InvolvedObject.Name] || time.Since(eventTime(e)) > eventWindow {
+			continue
+		}
+		matched = append(matched, e)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return eventTime(matched[i]).After(eventTime(matched[j]))
+	})
+
+	var out []string
+	for i, e := range matched {
+		if i == maxEvents {
+			break
+		}
+		out = append(out, fmt.Sprintf("%s/%s: %s: %s", strings.ToLower(e.InvolvedObject.Kind), e.InvolvedObject.Name, e.Reason, strings.TrimSpace(e.Message)))
+	}
+	return out
+}
+
+func eventTime(e corev1.Event) time.Time {
+	if !e.LastTimestamp.IsZero() {
+		return e.LastTimestamp.Time
+	}
+	if !e.EventTime.IsZero() {
+		return e.EventTime.Time
+	}
+	return e.CreationTimestamp.Time
+}
+
+// PrintStatus prints the health of every component, optionally waiting until
+// all installed components are ready
+func PrintStatus(c *k8s.Client, o Options) error {
+	if o.Output != "" && o.Output != "json" {
+		return fmt.Errorf("invalid output format %q, {json}", o.Output)
+	}
+
+	report, err := GetStatus(c, o)
+	if err != nil {
+		return err
+	}
+
+	if o.Wait {
+		deadline := time.Now().Add(o.WaitDuration)
+		for !report.Healthy {
+			if time.Now().After(deadline) {
+				if err := printReport(report, o.Output); err != nil {
+					return err
+				}
+				return fmt.Errorf("timed out after %s waiting for components to become ready", o.WaitDuration)
+			}
+			if o.Output == "" {
+				fmt.Printf("Waiting for components to become ready (%s)...\n", pending(report))
+			}
+			time.Sleep(2 * time.Second)
+
+			if report, err = GetStatus(c, o); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := printReport(report, o.Output); err != nil {
+		return err
+	}
+	if !report.Healthy && !o.Wait {
+		return errors.New("one or more components are not ready")
+	}
+	return nil
+}
+
+func pending(r *Report) string {
+	var names []string
+	for _, w := range r.Workloads {
+		if w.Installed && !w.Healthy() {
+			names = append(names, w.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func printReport(r *Report, output string) error {
+	if output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+
+	headerFmt := color.New(color.Underline).SprintfFunc()
+	tbl := summary.Heading("COMPONENT", "KIND", "NAME", "NAMESPACE", "DESIRED", "READY", "AVAILABLE", "RESTARTS", "STATUS", "IMAGE")
+	tbl.WithHeaderFormatter(headerFmt)
+	for _, w := range r.Workloads {
+		if !w.Installed {
+			tbl.AddRow(w.Component, w.Kind, w.Name, w.Namespace, "-", "-", "-", "-", "NOT INSTALLED", "-")
+			continue
+		}
+		state := "READY"
+		if !w.Healthy() {
+			state = "NOT READY"
+		}
+		tbl.AddRow(w.Component, w.Kind, w.Name, w.Namespace, w.Desired, w.Ready, w.Available, w.Restarts, state, strings.Join(w.Images, ","))
+	}
+	tbl.Print()
+
+	for _, w := range r.Workloads {
+		if len(w.Events) == 0 {
+			continue
+		}
+		fmt.Printf("\nRecent warnings for %s/%s:\n", strings.ToLower(w.Kind), w.Name)
+		for _, e := range w.Events {
+			fmt.Printf("  %s\n", e)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022 Authors of KubeArmor
+
+package summary
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/accuknox/accuknox-cli/grpcutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultTimeout of each attempt to connect to discovery engine
+const DefaultTimeout = 5 * time.Second
+
+// DefaultRetries is the number of attempts to connect to discovery engine
+// after the first one failed
+const DefaultRetries = 2
+
+// UnreachableError is returned when discovery engine can not be reached
+type UnreachableError struct {
+	Server string
+	Err    error
+}
+
+func (e *UnreachableError) Error() string {
+	return fmt.Sprintf("discovery engine is unreachable at %s: %v\nPossible troubleshooting:\n"+
+		"- Check if discovery engine is running\n"+
+		"- Create a portforward to discovery engine service using\n\t\033[1maccuknox port-forward discovery-engine\033[0m\n"+
+		"- Check the --server and TLS options", e.Server, e.Err)
+}
+
+func (e *UnreachableError) Unwrap() error {
+	return e.Err
+}
+
+// NoDataError is returned when discovery engine has no summary for the
+// namespace and labels requested
+type NoDataError struct {
+	Namespace string
+	Labels    string
+}
+
+func (e *NoDataError) Error() string {
+	var what []string
+	if e.Namespace != "" {
+		what = append(what, fmt.Sprintf("namespace %q", e.Namespace))
+	}
+	if e.Labels != "" {
+		what = append(what, fmt.Sprintf("labels %q", e.Labels))
+	}
+	if len(what) == 0 {
+		return "discovery engine has no summary data yet"
+	}
+	return "discovery engine has no summary data for " + strings.Join(what, " and ")
+}
+
+// server returns the address of discovery engine
+func server(o Options) string {
+	if o.GRPC != "" {
+		return o.GRPC
+	}
+	if val, ok := os.LookupEnv("DISCOVERY_SERVICE"); ok {
+		return val
+	}
+	return DefaultServer
+}
+
+// transportCredentials returns the credentials of the connection to discovery
+// engine, with a client certificate for mTLS when one is given
+func transportCredentials(o Options) (grpc.DialOption, error) {
+	return grpcutil.Credentials(grpcutil.TLS{
+		Enabled:        o.TLS,
+		ServerName:     o.TLSServerName,
+		CACertFile:     o.TLSCACert,
+		ClientCertFile: o.TLSClientCert,
+		ClientKeyFile:  o.TLSClientKey,
+	})
+}
+
+// connect connects to discovery engine, trying again with an increasing delay
+// when it can not be reached within the timeout or refuses the connection.
+// TLS handshake failures are not retried.
+func connect(o Options) (*grpc.ClientConn, error) {
+	addr := server(o)
+	timeout := o.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	creds, err := transportCredentials(o)
+	if err != nil {
+		return nil, err
+	}
+
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		conn, err := grpcutil.Dial(addr, creds, timeout)
+		if err == nil {
+			return conn, nil
+		}
+
+		var terr *grpcutil.TimeoutError
+		var cerr interface{ Temporary() bool }
+		switch {
+		case grpcutil.IsHandshakeError(err):
+			return nil, &UnreachableError{Server: addr, Err: err}
+		case !errors.As(err, &terr) && !errors.As(err, &cerr):
+			// not a connection error, e.g. an invalid address
+			return nil, &UnreachableError{Server: addr, Err: err}
+		case attempt >= o.Retries:
+			return nil, &UnreachableError{
+				Server: addr,
+				Err:    fmt.Errorf("no connection after %d attempts: %w", attempt+1, err),
+			}
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// isUnreachable reports whether a call failed because discovery engine could
+// not be reached
+func isUnreachable(err error) bool {
+	return status.Code(err) == codes.Unavailable
+}
@@ -0,0 +1,210 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022 Authors of KubeArmor
+
+package summary
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	opb "github.com/accuknox/auto-policy-discovery/src/protobuf/v1/observability"
+	"github.com/fatih/color"
+	"golang.org/x/exp/slices"
+)
+
+// Changes of the entries between two summaries
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+)
+
+// DiffOutputs lists the supported output formats of a diff
+var DiffOutputs = []string{OutputTable, OutputJSON}
+
+// Change is an entry that appeared in or disappeared from the summary of a
+// workload
+type Change struct {
+	Change      string `json:"change"`
+	Workload    string `json:"workload"`
+	Namespace   string `json:"namespace"`
+	Type        string `json:"type"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination"`
+	Status      string `json:"status,omitempty"`
+}
+
+// join joins the non empty parts
+func join(parts ...string) string {
+	var out []string
+	for _, p := range parts {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// diffEntries returns the entries of the summary of a pod, identified by
+// everything but their count and time
+func diffEntries(res *opb.LogsResponse) []Change {
+	var out []Change
+	addSources := func(t string, sources []*opb.ListOfSource) {
+		for _, src := range sources {
+			for _, dst := range src.ListOfDestination {
+				out = append(out, Change{Type: t, Source: src.Source, Destination: dst.Destination, Status: strings.ToUpper(dst.Status)})
+			}
+		}
+	}
+	addConnections := func(t string, conns []*opb.ListOfConnection) {
+		for _, conn := range conns {
+			dst := join(conn.DestinationLabels, conn.DestinationNamespace, fmt.Sprintf("%s/%d", conn.Protocol, conn.Port))
+			out = append(out, Change{Type: t, Destination: dst, Status: strings.ToUpper(conn.Status)})
+		}
+	}
+	addServerConns := func(direction string, conns []*opb.ServerConnections) {
+		for _, conn := range conns {
+			out = append(out, Change{Type: TypeServerConn, Source: direction, Destination: join(conn.AddressFamily, conn.Path)})
+		}
+	}
+
+	addSources(TypeProcess, res.ListOfProcess)
+	addSources(TypeFile, res.ListOfFile)
+	addSources(TypeNetwork, res.ListOfNetwork)
+	addConnections(TypeIngress, res.Ingress)
+	addConnections(TypeEgress, res.Egress)
+	addServerConns("incoming", res.InServerConn)
+	addServerConns("outgoing", res.OutServerConn)
+	return out
+}
+
+var (
+	// deploymentPod matches the name of a pod of a Deployment, suffixed with
+	// the hash of its ReplicaSet and its own random suffix
+	deploymentPod = regexp.MustCompile(`^(.+)-[bcdfghjklmnpqrstvwxz2456789]{6,10}-[bcdfghjklmnpqrstvwxz2456789]{5}$`)
+	// generatedPod matches the name of a pod of a DaemonSet or a Job, suffixed
+	// with a random suffix
+	generatedPod = regexp.MustCompile(`^(.+)-[bcdfghjklmnpqrstvwxz2456789]{5}$`)
+)
+
+// Workload returns the name of the workload of a pod, its name without the
+// suffixes Kubernetes generates. The pods of a StatefulSet keep their name.
+func Workload(pod string) string {
+	if m := deploymentPod.FindStringSubmatch(pod); m != nil {
+		return m[1]
+	}
+	if m := generatedPod.FindStringSubmatch(pod); m != nil {
+		return m[1]
+	}
+	return pod
+}
+
+// workload holds the entries of the pods of a workload
+type workload struct {
+	name      string
+	namespace string
+	entries   []Change
+}
+
+// workloads groups the entries of the pods by workload, so that pods renamed
+// by a deploy are compared with the pods they replaced
+func workloads(pods []*opb.LogsResponse) ([]string, map[string]*workload) {
+	var keys []string
+	out := map[string]*workload{}
+	for _, res := range pods {
+		name := Workload(res.PodDetail)
+		key := path.Join(res.Namespace, name)
+		w, ok := out[key]
+		if !ok {
+			w = &workload{name: name, namespace: res.Namespace}
+			out[key] = w
+			keys = append(keys, key)
+		}
+		w.entries = append(w.entries, diffEntries(res)...)
+	}
+	return keys, out
+}
+
+// changes returns the entries of from missing in to
+func changes(change string, w *workload, from, to []Change) []Change {
+	seen := map[Change]bool{}
+	for _, e := range to {
+		seen[e] = true
+	}
+
+	var out []Change
+	for _, e := range from {
+		if seen[e] {
+			continue
+		}
+		seen[e] = true
+		e.Change, e.Workload, e.Namespace = change, w.name, w.namespace
+		out = append(out, e)
+	}
+	return out
+}
+
+// Diff returns the entries that appeared in or disappeared from the summaries
+// between two snapshots, per workload. A status change shows as the entry
+// being removed and added back.
+func Diff(before, after []*opb.LogsResponse) []Change {
+	oldKeys, old := workloads(before)
+	newKeys, cur := workloads(after)
+
+	out := []Change{}
+	for _, key := range newKeys {
+		w := cur[key]
+		var prev []Change
+		if o, ok := old[key]; ok {
+			prev = o.entries
+		}
+		out = append(out, changes(ChangeAdded, w, w.entries, prev)...)
+		out = append(out, changes(ChangeRemoved, w, prev, w.entries)...)
+	}
+	for _, key := range oldKeys {
+		if _, ok := cur[key]; !ok {
+			out = append(out, changes(ChangeRemoved, old[key], old[key].entries, nil)...)
+		}
+	}
+	return out
+}
+
+// NewViolations returns the number of DENY and AUDIT entries that appeared
+func NewViolations(changes []Change) int {
+	n := 0
+	for _, c := range changes {
+		if c.Change == ChangeAdded && slices.Contains([]string{"DENY", "BLOCK", "AUDIT"}, c.Status) {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteDiff writes the changes as a table or as JSON
+func WriteDiff(w io.Writer, output string, changes []Change) error {
+	switch output {
+	case "", OutputTable:
+		tbl := Heading("CHANGE", "WORKLOAD", "NAMESPACE", "TYPE", "SOURCE", "DESTINATION", "STATUS")
+		tbl.WithHeaderFormatter(color.New(color.Underline).SprintfFunc()).WithWriter(w)
+		for _, c := range changes {
+			sign := "+ " + c.Change
+			if c.Change == ChangeRemoved {
+				sign = "- " + c.Change
+			}
+			tbl.AddRow(sign, c.Workload, c.Namespace, c.Type, c.Source, c.Destination, c.Status)
+		}
+		tbl.Print()
+		return nil
+	case OutputJSON:
+		b, err := json.MarshalIndent(changes, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	}
+	return fmt.Errorf("invalid output format %q, expected one of %s", output, strings.Join(DiffOutputs, "|"))
+}
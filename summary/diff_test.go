@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022 Authors of KubeArmor
+
+package summary
+
+import (
+	"testing"
+
+	opb "github.com/accuknox/auto-policy-discovery/src/protobuf/v1/observability"
+)
+
+func processes(pod, namespace string, dests ...*opb.ListOfDestination) *opb.LogsResponse {
+	return &opb.LogsResponse{
+		PodDetail:     pod,
+		Namespace:     namespace,
+		ListOfProcess: []*opb.ListOfSource{{Source: "/bin/sh", ListOfDestination: dests}},
+	}
+}
+
+func dest(name, status string, count int32) *opb.ListOfDestination {
+	return &opb.ListOfDestination{Destination: name, Status: status, Count: count}
+}
+
+func TestWorkload(t *testing.T) {
+	tests := map[string]string{
+		"web-7d4b9c8f6d-x2k4p":   "web",
+		"my-app-5b7fd9c6b-qj8zm": "my-app",
+		"fluentd-8m4xq":          "fluentd",
+		"db-0":                   "db-0",
+		"nginx":                  "nginx",
+	}
+	for pod, want := range tests {
+		if got := Workload(pod); got != want {
+			t.Errorf("Workload(%q) = %q, want %q", pod, got, want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name       string
+		before     []*opb.LogsResponse
+		after      []*opb.LogsResponse
+		changes    []Change
+		violations int
+	}{
+		{
+			name:    "redeployed pods are compared with the pods they replaced",
+			before:  []*opb.LogsResponse{processes("web-7d4b9c8f6d-x2k4p", "default", dest("/bin/ls", "deny", 1))},
+			after:   []*opb.LogsResponse{processes("web-5b7fd9c6b-qj8zm", "default", dest("/bin/ls", "deny", 7))},
+			changes: []Change{},
+		},
+		{
+			name:   "replicas are merged",
+			before: []*opb.LogsResponse{processes("web-7d4b9c8f6d-x2k4p", "default", dest("/bin/ls", "allow", 1))},
+			after: []*opb.LogsResponse{
+				processes("web-5b7fd9c6b-qj8zm", "default", dest("/bin/ls", "allow", 1)),
+				processes("web-5b7fd9c6b-d9w2t", "default", dest("/bin/cat", "audit", 1)),
+			},
+			changes: []Change{
+				{Change: ChangeAdded, Workload: "web", Namespace: "default", Type: TypeProcess, Source: "/bin/sh", Destination: "/bin/cat", Status: "AUDIT"},
+			},
+			violations: 1,
+		},
+		{
+			name:   "status changes",
+			before: []*opb.LogsResponse{processes("web-0", "default", dest("/bin/ls", "allow", 1))},
+			after:  []*opb.LogsResponse{processes("web-0", "default", dest("/bin/ls", "deny", 1))},
+			changes: []Change{
+				{Change: ChangeAdded, Workload: "web-0", Namespace: "default", Type: TypeProcess, Source: "/bin/sh", Destination: "/bin/ls", Status: "DENY"},
+				{Change: ChangeRemoved, Workload: "web-0", Namespace: "default", Type: TypeProcess, Source: "/bin/sh", Destination: "/bin/ls", Status: "ALLOW"},
+			},
+			violations: 1,
+		},
+		{
+			name:   "removed workloads",
+			before: []*opb.LogsResponse{processes("web-0", "default", dest("/bin/ls", "deny", 1))},
+			changes: []Change{
+				{Change: ChangeRemoved, Workload: "web-0", Namespace: "default", Type: TypeProcess, Source: "/bin/sh", Destination: "/bin/ls", Status: "DENY"},
+			},
+		},
+		{
+			name:   "same name in another namespace",
+			before: []*opb.LogsResponse{processes("web-0", "default", dest("/bin/ls", "allow", 1))},
+			after:  []*opb.LogsResponse{processes("web-0", "prod", dest("/bin/ls", "allow", 1))},
+			changes: []Change{
+				{Change: ChangeAdded, Workload: "web-0", Namespace: "prod", Type: TypeProcess, Source: "/bin/sh", Destination: "/bin/ls", Status: "ALLOW"},
+				{Change: ChangeRemoved, Workload: "web-0", Namespace: "default", Type: TypeProcess, Source: "/bin/sh", Destination: "/bin/ls", Status: "ALLOW"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := Diff(tt.before, tt.after)
+			if len(changes) != len(tt.changes) {
+				t.Fatalf("got %d changes %v, want %d %v", len(changes), changes, len(tt.changes), tt.changes)
+			}
+			for i := range changes {
+				if changes[i] != tt.changes[i] {
+					t.Errorf("change %d: got %v, want %v", i, changes[i], tt.changes[i])
+				}
+			}
+			if n := NewViolations(changes); n != tt.violations {
+				t.Errorf("got %d violations, want %d", n, tt.violations)
+			}
+		})
+	}
+}
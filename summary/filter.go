@@ -0,0 +1,261 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022 Authors of KubeArmor
+
+package summary
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	opb "github.com/accuknox/auto-policy-discovery/src/protobuf/v1/observability"
+	"golang.org/x/exp/slices"
+)
+
+// Table types selected with the Types option
+const (
+	TypeProcess    = "process"
+	TypeFile       = "file"
+	TypeNetwork    = "network"
+	TypeIngress    = "ingress"
+	TypeEgress     = "egress"
+	TypeServerConn = "server-conn"
+)
+
+// Types lists the table types of a summary
+var Types = []string{TypeProcess, TypeFile, TypeNetwork, TypeIngress, TypeEgress, TypeServerConn}
+
+// Statuses lists the statuses the entries can be filtered on
+var Statuses = []string{"allow", "deny", "audit"}
+
+// Sort orders of the entries
+const (
+	SortByCount = "count"
+	SortByTime  = "time"
+)
+
+// entry is the part of a destination or a connection the filters look at
+type entry struct {
+	status  string
+	count   int32
+	updated int64
+}
+
+// filter selects the entries of the summaries
+type filter struct {
+	pods   []string
+	types  []string
+	status []string
+	since  time.Time
+	sortBy string
+	top    int
+}
+
+// filtered reports whether the entries themselves are filtered, in which case
+// the pods left without any entry are dropped
+func (f *filter) filtered() bool {
+	return len(f.types) > 0 || len(f.status) > 0 || !f.since.IsZero()
+}
+
+// parseSince accepts a RFC3339 time or a duration back from now
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since %q, expected a duration such as 1h or a RFC3339 time", s)
+	}
+	return t, nil
+}
+
+func newFilter(o Options, now time.Time) (*filter, error) {
+	f := &filter{pods: o.Pods, sortBy: o.SortBy, top: o.Top}
+
+	for _, t := range o.Types {
+		t = strings.ToLower(t)
+		if !slices.Contains(Types, t) {
+			return nil, fmt.Errorf("invalid type %q, expected one of %s", t, strings.Join(Types, "|"))
+		}
+		f.types = append(f.types, t)
+	}
+	for _, s := range o.Status {
+		s = strings.ToLower(s)
+		if !slices.Contains(Statuses, s) {
+			return nil, fmt.Errorf("invalid status %q, expected one of %s", s, strings.Join(Statuses, "|"))
+		}
+		f.status = append(f.status, s)
+	}
+	for _, p := range o.Pods {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid pod pattern %q: %w", p, err)
+		}
+	}
+	if o.Since != "" {
+		since, err := parseSince(o.Since, now)
+		if err != nil {
+			return nil, err
+		}
+		f.since = since
+	}
+	switch o.SortBy {
+	case "", SortByCount, SortByTime:
+	default:
+		return nil, fmt.Errorf("invalid sort order %q, expected %s or %s", o.SortBy, SortByCount, SortByTime)
+	}
+	if o.Top < 0 {
+		return nil, fmt.Errorf("invalid --top %d", o.Top)
+	}
+	// the top entries are the most frequent unless told otherwise
+	if f.top > 0 && f.sortBy == "" {
+		f.sortBy = SortByCount
+	}
+	return f, nil
+}
+
+func (f *filter) matchPod(res *opb.LogsResponse) bool {
+	if len(f.pods) == 0 {
+		return true
+	}
+	for _, p := range f.pods {
+		if ok, _ := path.Match(p, res.PodDetail); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *filter) matchType(t string) bool {
+	return len(f.types) == 0 || slices.Contains(f.types, t)
+}
+
+func (f *filter) match(e entry) bool {
+	if len(f.status) > 0 && !slices.Contains(f.status, strings.ToLower(e.status)) {
+		return false
+	}
+	if !f.since.IsZero() && time.Unix(e.updated, 0).Before(f.since) {
+		return false
+	}
+	return true
+}
+
+// less orders the entries by decreasing count or time
+func (f *filter) less(a, b entry) bool {
+	if f.sortBy == SortByTime {
+		return a.updated > b.updated
+	}
+	return a.count > b.count
+}
+
+// sources filters, sorts and truncates the destinations of a list of sources.
+// With a sort order the sources are ordered by their first destination.
+func (f *filter) sources(t string, sources []*opb.ListOfSource) []*opb.ListOfSource {
+	if !f.matchType(t) {
+		return nil
+	}
+
+	type dest struct {
+		source int
+		dst    *opb.ListOfDestination
+	}
+	var dests []dest
+	for i, src := range sources {
+		for _, dst := range src.ListOfDestination {
+			if f.match(entry{dst.Status, dst.Count, dst.LastUpdatedTime}) {
+				dests = append(dests, dest{i, dst})
+			}
+		}
+	}
+	if f.sortBy != "" {
+		sort.SliceStable(dests, func(i, j int) bool {
+			a, b := dests[i].dst, dests[j].dst
+			return f.less(entry{a.Status, a.Count, a.LastUpdatedTime}, entry{b.Status, b.Count, b.LastUpdatedTime})
+		})
+	}
+	if f.top > 0 && len(dests) > f.top {
+		dests = dests[:f.top]
+	}
+
+	var out []*opb.ListOfSource
+	bySource := map[int]*opb.ListOfSource{}
+	for _, d := range dests {
+		src, ok := bySource[d.source]
+		if !ok {
+			src = &opb.ListOfSource{Source: sources[d.source].Source}
+			bySource[d.source] = src
+			out = append(out, src)
+		}
+		src.ListOfDestination = append(src.ListOfDestination, d.dst)
+	}
+	return out
+}
+
+func (f *filter) connections(t string, conns []*opb.ListOfConnection) []*opb.ListOfConnection {
+	if !f.matchType(t) {
+		return nil
+	}
+
+	var out []*opb.ListOfConnection
+	for _, conn := range conns {
+		if f.match(entry{conn.Status, conn.Count, conn.LastUpdatedTime}) {
+			out = append(out, conn)
+		}
+	}
+	if f.sortBy != "" {
+		sort.SliceStable(out, func(i, j int) bool {
+			a, b := out[i], out[j]
+			return f.less(entry{a.Status, a.Count, a.LastUpdatedTime}, entry{b.Status, b.Count, b.LastUpdatedTime})
+		})
+	}
+	if f.top > 0 && len(out) > f.top {
+		out = out[:f.top]
+	}
+	return out
+}
+
+// serverConns filters the server connections. They carry neither a status
+// nor a time, so they are dropped when filtering on those.
+func (f *filter) serverConns(conns []*opb.ServerConnections) []*opb.ServerConnections {
+	if !f.matchType(TypeServerConn) || len(f.status) > 0 || !f.since.IsZero() {
+		return nil
+	}
+	if f.top > 0 && len(conns) > f.top {
+		conns = conns[:f.top]
+	}
+	return conns
+}
+
+func isEmpty(res *opb.LogsResponse) bool {
+	return len(res.ListOfProcess) == 0 && len(res.ListOfFile) == 0 && len(res.ListOfNetwork) == 0 &&
+		len(res.Ingress) == 0 && len(res.Egress) == 0 &&
+		len(res.InServerConn) == 0 && len(res.OutServerConn) == 0
+}
+
+// apply returns the summaries of the selected pods holding the selected
+// entries
+func (f *filter) apply(pods []*opb.LogsResponse) []*opb.LogsResponse {
+	var out []*opb.LogsResponse
+	for _, res := range pods {
+		if !f.matchPod(res) {
+			continue
+		}
+		res = &opb.LogsResponse{
+			PodDetail:     res.PodDetail,
+			Namespace:     res.Namespace,
+			ListOfProcess: f.sources(TypeProcess, res.ListOfProcess),
+			ListOfFile:    f.sources(TypeFile, res.ListOfFile),
+			ListOfNetwork: f.sources(TypeNetwork, res.ListOfNetwork),
+			Ingress:       f.connections(TypeIngress, res.Ingress),
+			Egress:        f.connections(TypeEgress, res.Egress),
+			InServerConn:  f.serverConns(res.InServerConn),
+			OutServerConn: f.serverConns(res.OutServerConn),
+		}
+		if f.filtered() && isEmpty(res) {
+			continue
+		}
+		out = append(out, res)
+	}
+	return out
+}
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 
 	"github.com/fatih/color"
+	"golang.org/x/term"
 )
 
 var (
@@ -29,12 +31,40 @@ var (
 
 	// DefaultWidthFunc specifies the default WidthFunc for calculating column widths
 	DefaultWidthFunc WidthFunc = utf8.RuneCountInString
+
+	// DefaultMaxWidth specifies the default maximum width of a table. 0 uses the
+	// width of the terminal the table is written to, a negative width disables
+	// the limit.
+	DefaultMaxWidth = 0
+
+	// DefaultOverflow specifies how the cells wider than their column are shown.
+	DefaultOverflow = OverflowTruncate
 )
 
+// minColumnWidth is the width under which the columns are not shrunk to fit
+// the maximum width of the table
+const minColumnWidth = 6
+
+// ellipsis ends the truncated cells
+const ellipsis = "…"
+
 type Formatter func(string, ...interface{}) string
 
 type WidthFunc func(string) int
 
+// RowFormatter returns the Formatter of the cells of the i-th row, or nil
+type RowFormatter func(i int) Formatter
+
+// Overflow tells how the cells wider than their column are shown
+type Overflow int
+
+const (
+	// OverflowTruncate cuts the cells, ending them with an ellipsis
+	OverflowTruncate Overflow = iota
+	// OverflowWrap wraps the cells over several lines
+	OverflowWrap
+)
+
 type Table interface {
 	WithHeaderFormatter(f Formatter) Table
 	WithAllowFormatter(f Formatter) Table
@@ -43,6 +73,11 @@ type Table interface {
 	WithPadding(p int) Table
 	WithWriter(w io.Writer) Table
 	WithWidthFunc(f WidthFunc) Table
+	WithRowFormatter(f RowFormatter) Table
+	WithMaxWidth(w int) Table
+	WithOverflow(o Overflow) Table
+	WithColumnOverflow(column string, o Overflow) Table
+	WithColumns(columns ...string) Table
 
 	AddRow(vals ...interface{}) Table
 	SetRows(rows [][]string) Table
@@ -59,6 +94,8 @@ func Heading(columnHeaders ...interface{}) Table {
 	t.WithDenyFormatter(DefaultDenyFormatter)
 	t.WithAuditFormatter(DefaultAuditFormatter)
 	t.WithWidthFunc(DefaultWidthFunc)
+	t.WithMaxWidth(DefaultMaxWidth)
+	t.WithOverflow(DefaultOverflow)
 
 	for i, col := range columnHeaders {
 		t.header[i] = fmt.Sprint(col)
@@ -75,10 +112,22 @@ type table struct {
 	Padding         int
 	Writer          io.Writer
 	Width           WidthFunc
+	RowFormatter    RowFormatter
+	MaxWidth        int
+	Overflow        Overflow
+	// ColumnOverflow overrides Overflow for some columns, by name
+	ColumnOverflow map[string]Overflow
+	// Columns are the names of the columns printed, in order, or every
+	// column when it is empty
+	Columns []string
 
 	header []string
 	rows   [][]string
 	widths []int
+	// columns are the indexes of the columns printed and right the ones
+	// aligned to the right
+	columns []int
+	right   []bool
 }
 
 func (t *table) WithHeaderFormatter(f Formatter) Table {
@@ -124,6 +173,39 @@ func (t *table) WithWidthFunc(f WidthFunc) Table {
 	return t
 }
 
+func (t *table) WithRowFormatter(f RowFormatter) Table {
+	t.RowFormatter = f
+	return t
+}
+
+// WithMaxWidth limits the width of the table, shrinking its widest columns.
+// 0 uses the width of the terminal the table is written to, a negative width
+// disables the limit.
+func (t *table) WithMaxWidth(w int) Table {
+	t.MaxWidth = w
+	return t
+}
+
+func (t *table) WithOverflow(o Overflow) Table {
+	t.Overflow = o
+	return t
+}
+
+func (t *table) WithColumnOverflow(column string, o Overflow) Table {
+	if t.ColumnOverflow == nil {
+		t.ColumnOverflow = map[string]Overflow{}
+	}
+	t.ColumnOverflow[strings.ToUpper(column)] = o
+	return t
+}
+
+// WithColumns selects the columns printed by name, in the order given. A
+// table holding none of the columns is printed in full.
+func (t *table) WithColumns(columns ...string) Table {
+	t.Columns = columns
+	return t
+}
+
 func (t *table) AddRow(vals ...interface{}) Table {
 	row := make([]string, len(t.header))
 	for i, val := range vals {
@@ -145,7 +227,7 @@ func (t *table) SetRows(rows [][]string) Table {
 		if len(row) > headerLength {
 			t.rows = append(t.rows, row[:headerLength])
 		} else {
-			t.rows = append(t.rows, row)
+			t.rows = append(t.rows, append(row, make([]string, headerLength-len(row))...))
 		}
 	}
 
@@ -154,67 +236,233 @@ func (t *table) SetRows(rows [][]string) Table {
 
 func (t *table) Print() {
 	if len(t.rows) == 0 {
-		fmt.Println("No Data")
+		fmt.Fprintln(t.Writer, "No Data")
 		return
 	}
-	format := strings.Repeat("%s", len(t.header)) + "\n"
+	t.selectColumns()
+	format := strings.Repeat("%s", len(t.columns)) + "\n"
 	t.calculateWidths()
 
 	t.printHeader(format)
 
-	for _, row := range t.rows {
-		t.printRow(format, row)
+	for i, row := range t.rows {
+		var f Formatter
+		if t.RowFormatter != nil {
+			f = t.RowFormatter(i)
+		}
+		t.printRow(format, row, f)
+	}
+}
+
+func (t *table) selectColumns() {
+	t.columns = nil
+	matched := false
+	for _, name := range t.Columns {
+		for i, h := range t.header {
+			if strings.EqualFold(name, h) {
+				t.columns = append(t.columns, i)
+				matched = matched || h != ""
+				break
+			}
+		}
+	}
+	if !matched {
+		t.columns = nil
+		for i := range t.header {
+			t.columns = append(t.columns, i)
+		}
+	}
+
+	// numeric columns are aligned to the right
+	t.right = make([]bool, len(t.columns))
+	for c, i := range t.columns {
+		numeric := false
+		for _, row := range t.rows {
+			if row[i] == "" {
+				continue
+			}
+			if _, err := strconv.ParseFloat(row[i], 64); err != nil {
+				numeric = false
+				break
+			}
+			numeric = true
+		}
+		t.right[c] = numeric
 	}
 }
 
+// maxWidth returns the maximum width of the table, or 0 when it is unlimited
+func (t *table) maxWidth() int {
+	if t.MaxWidth != 0 {
+		if t.MaxWidth < 0 {
+			return 0
+		}
+		return t.MaxWidth
+	}
+	if f, ok := t.Writer.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		if w, _, err := term.GetSize(int(f.Fd())); err == nil {
+			return w
+		}
+	}
+	return 0
+}
+
 func (t *table) printHeader(format string) {
-	vals := t.applyWidths(t.header, t.widths)
-	if t.HeaderFormatter != nil {
-		txt := t.HeaderFormatter(format, vals...)
+	vals := t.applyWidths(t.header, nil)
+	if t.HeaderFormatter != nil && !color.NoColor {
+		txt := t.HeaderFormatter(format, vals[0]...)
 		fmt.Fprint(t.Writer, txt)
 	} else {
-		fmt.Fprintf(t.Writer, format, vals...)
+		fmt.Fprintf(t.Writer, format, vals[0]...)
+	}
+	for _, line := range vals[1:] {
+		fmt.Fprintf(t.Writer, format, line...)
 	}
 }
 
-func (t *table) printRow(format string, row []string) {
-	vals := t.applyWidths(row, t.widths)
-
-	fmt.Fprintf(t.Writer, format, vals...)
+func (t *table) printRow(format string, row []string, f Formatter) {
+	for _, line := range t.applyWidths(row, f) {
+		fmt.Fprintf(t.Writer, format, line...)
+	}
 }
 
+// calculateWidths sets the width of the content of the columns, shrinking the
+// widest ones until the table fits its maximum width
 func (t *table) calculateWidths() {
-	t.widths = make([]int, len(t.header))
-	for _, row := range t.rows {
-		for i, v := range row {
-			if w := t.Width(v) + t.Padding; w > t.widths[i] {
-				t.widths[i] = w
+	t.widths = make([]int, len(t.columns))
+	for c, i := range t.columns {
+		t.widths[c] = t.Width(t.header[i])
+		for _, row := range t.rows {
+			if w := t.Width(row[i]); w > t.widths[c] {
+				t.widths[c] = w
+			}
+		}
+	}
+
+	max := t.maxWidth()
+	if max == 0 {
+		return
+	}
+	total := t.Padding * (len(t.widths) - 1)
+	for _, w := range t.widths {
+		total += w
+	}
+	for ; total > max; total-- {
+		widest := -1
+		for c, w := range t.widths {
+			if w > minColumnWidth && (widest < 0 || w > t.widths[widest]) {
+				widest = c
 			}
 		}
+		if widest < 0 {
+			return
+		}
+		t.widths[widest]--
+	}
+}
+
+func (t *table) overflow(i int) Overflow {
+	if o, ok := t.ColumnOverflow[strings.ToUpper(t.header[i])]; ok {
+		return o
+	}
+	return t.Overflow
+}
+
+// fit returns the lines of a cell no wider than w
+func (t *table) fit(s string, w int, o Overflow) []string {
+	if w <= 0 || t.Width(s) <= w {
+		return []string{s}
+	}
+	if o == OverflowTruncate {
+		return []string{t.cut(s, w-t.Width(ellipsis)) + ellipsis}
+	}
+
+	var lines []string
+	for t.Width(s) > w {
+		line := t.cut(s, w)
+		// break after a separator when there is one in the second half
+		if i := strings.LastIndexAny(line, " /,"); i >= len(line)/2 {
+			line = line[:i+1]
+		}
+		lines = append(lines, line)
+		s = s[len(line):]
 	}
+	return append(lines, s)
+}
 
-	for i, v := range t.header {
-		if w := t.Width(v) + t.Padding; w > t.widths[i] {
-			t.widths[i] = w
+// cut returns the longest prefix of s no wider than w
+func (t *table) cut(s string, w int) string {
+	for i := range s {
+		if i > 0 && t.Width(s[:i]) > w {
+			return s[:prevRune(s, i)]
 		}
 	}
+	if t.Width(s) > w {
+		return s[:prevRune(s, len(s))]
+	}
+	return s
+}
+
+func prevRune(s string, i int) int {
+	_, size := utf8.DecodeLastRuneInString(s[:i])
+	return i - size
+}
+
+// statusFormatter returns the Formatter of a status cell, or nil
+func (t *table) statusFormatter(s string) Formatter {
+	switch s {
+	case "ALLOW":
+		return t.AllowFormatter
+	case "DENY", "BLOCK":
+		return t.DenyFormatter
+	case "AUDIT":
+		return t.AuditFormatter
+	}
+	return nil
 }
 
-func (t *table) applyWidths(row []string, widths []int) []interface{} {
-	out := make([]interface{}, len(row))
-	allow := color.New(color.FgGreen).SprintfFunc()
-	deny := color.New(color.FgRed).SprintfFunc()
-	audit := color.New(color.FgYellow).SprintfFunc()
-	for i, s := range row {
-		switch s {
-		case "ALLOW":
-			s = allow(s)
-		case "DENY", "BLOCK":
-			s = deny(s)
-		case "AUDIT":
-			s = audit(s)
+// applyWidths returns the lines of a row, its cells fitted to the width of
+// their column and padded. The statuses are coloured with their Formatter and
+// the other cells with f when it is not nil.
+func (t *table) applyWidths(row []string, f Formatter) [][]interface{} {
+	cells := make([][]string, len(t.columns))
+	height := 1
+	for c, i := range t.columns {
+		cells[c] = t.fit(row[i], t.widths[c], t.overflow(i))
+		if len(cells[c]) > height {
+			height = len(cells[c])
+		}
+	}
+
+	out := make([][]interface{}, height)
+	for l := range out {
+		out[l] = make([]interface{}, len(t.columns))
+		for c, i := range t.columns {
+			s := ""
+			if l < len(cells[c]) {
+				s = cells[c][l]
+			}
+			pad := t.lenOffset(s, t.widths[c])
+
+			format := f
+			if sf := t.statusFormatter(row[i]); sf != nil {
+				format = sf
+			}
+			if format != nil && s != "" && !color.NoColor {
+				s = format("%s", s)
+			}
+
+			switch {
+			case t.right[c]:
+				s = pad + s
+			case c < len(t.columns)-1:
+				s += pad
+			}
+			if c < len(t.columns)-1 {
+				s += strings.Repeat(" ", t.Padding)
+			}
+			out[l][c] = s
 		}
-		out[i] = s + t.lenOffset(s, widths[i])
 	}
 	return out
 }
@@ -0,0 +1,325 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022 Authors of KubeArmor
+
+package summary
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	opb "github.com/accuknox/auto-policy-discovery/src/protobuf/v1/observability"
+	"github.com/fatih/color"
+	"golang.org/x/exp/slices"
+	"google.golang.org/protobuf/encoding/protojson"
+	"sigs.k8s.io/yaml"
+)
+
+// Output formats of the summary
+const (
+	OutputTable    = "table"
+	OutputJSON     = "json"
+	OutputYAML     = "yaml"
+	OutputCSV      = "csv"
+	OutputMarkdown = "markdown"
+	OutputHTML     = "html"
+)
+
+// Outputs lists the supported output formats
+var Outputs = []string{OutputTable, OutputJSON, OutputYAML, OutputCSV, OutputMarkdown, OutputHTML}
+
+func validateOutput(output string) error {
+	if output != "" && !slices.Contains(Outputs, output) {
+		return fmt.Errorf("invalid output format %q, expected one of %s", output, strings.Join(Outputs, "|"))
+	}
+	return nil
+}
+
+// render writes the summaries of the pods in the output format of the options
+func render(w io.Writer, o Options, pods []*opb.LogsResponse) error {
+	switch o.Output {
+	case OutputJSON:
+		return writeJSON(w, pods)
+	case OutputYAML:
+		return writeYAML(w, pods)
+	case OutputCSV:
+		if o.OutputDir != "" {
+			return writeCSVFiles(pods, o)
+		}
+		return writeCSV(w, pods, o)
+	case OutputMarkdown:
+		return writeMarkdown(w, pods, o)
+	case OutputHTML:
+		return writeHTML(w, pods, o)
+	default:
+		writeTables(w, pods, o, nil)
+		return nil
+	}
+}
+
+func writeTables(w io.Writer, pods []*opb.LogsResponse, o Options, h *highlight) {
+	if len(pods) == 0 {
+		fmt.Fprintln(w, "No Data")
+		return
+	}
+	headerFmt := color.New(color.Underline).SprintfFunc()
+	for _, res := range pods {
+		fmt.Fprintln(w, "\n\n**********************************************************************")
+		fmt.Fprintln(w, "\nPod Name : ", res.PodDetail)
+		fmt.Fprintln(w, "\nNamespace : ", res.Namespace)
+		for _, s := range sections(res, o.TimeFormat, o.Types) {
+			fmt.Fprintf(w, "\n%s :\n\n", s.title)
+			if h != nil {
+				s = h.mark(res, s)
+			}
+			header := make([]interface{}, len(s.header))
+			for i, c := range s.header {
+				header[i] = c
+			}
+			tbl := Heading(header...)
+			tbl.WithHeaderFormatter(headerFmt).WithWriter(w).WithMaxWidth(o.MaxWidth)
+			if o.Wrap {
+				tbl.WithOverflow(OverflowWrap)
+			}
+			if len(o.Columns) > 0 {
+				columns := o.Columns
+				if h != nil {
+					// the marks of the rows are kept
+					columns = append([]string{""}, columns...)
+				}
+				tbl.WithColumns(columns...)
+			}
+			tbl.SetRows(s.rows)
+			if h != nil {
+				tbl.WithRowFormatter(h.formatter(s))
+			}
+			tbl.Print()
+		}
+	}
+}
+
+// marshalJSON returns the summaries as a JSON array of LogsResponse
+func marshalJSON(pods []*opb.LogsResponse) ([]byte, error) {
+	msgs := make([]json.RawMessage, 0, len(pods))
+	for _, res := range pods {
+		b, err := protojson.Marshal(res)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, b)
+	}
+	return json.MarshalIndent(msgs, "", "  ")
+}
+
+func writeJSON(w io.Writer, pods []*opb.LogsResponse) error {
+	b, err := marshalJSON(pods)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+func writeYAML(w io.Writer, pods []*opb.LogsResponse) error {
+	b, err := marshalJSON(pods)
+	if err != nil {
+		return err
+	}
+	if b, err = yaml.JSONToYAML(b); err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// csvTables groups the rows of every pod by table type, each row prefixed with
+// the pod and its namespace
+func csvTables(pods []*opb.LogsResponse, o Options) []section {
+	var tables []section
+	for _, res := range pods {
+		for i, s := range sections(res, o.TimeFormat, o.Types) {
+			if len(tables) <= i {
+				tables = append(tables, section{
+					name:   s.name,
+					header: append([]string{"POD", "NAMESPACE"}, s.header...),
+				})
+			}
+			for _, row := range s.rows {
+				tables[i].rows = append(tables[i].rows, append([]string{res.PodDetail, res.Namespace}, row...))
+			}
+		}
+	}
+	return tables
+}
+
+func writeCSVTable(w io.Writer, s section) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(s.header); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(s.rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// writeCSV writes one section per table type, each introduced by a "# name"
+// line and separated by an empty line
+func writeCSV(w io.Writer, pods []*opb.LogsResponse, o Options) error {
+	for i, s := range csvTables(pods, o) {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "# %s\n", s.name)
+		if err := writeCSVTable(w, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCSVFiles writes one file per table type in the output directory
+func writeCSVFiles(pods []*opb.LogsResponse, o Options) error {
+	if err := os.MkdirAll(o.OutputDir, 0o755); err != nil {
+		return err
+	}
+	for _, s := range csvTables(pods, o) {
+		path := filepath.Join(o.OutputDir, s.name+".csv")
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		err = writeCSVTable(f, s)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("unable to write %s: %w", path, err)
+		}
+		fmt.Printf("wrote %s (%d rows)\n", path, len(s.rows))
+	}
+	return nil
+}
+
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+func writeMarkdown(w io.Writer, pods []*opb.LogsResponse, o Options) error {
+	fmt.Fprintf(w, "# Workload summary\n\nGenerated on %s.\n", time.Now().Format(o.TimeFormat))
+	for _, res := range pods {
+		fmt.Fprintf(w, "\n## %s\n\nNamespace: `%s`\n", markdownCell(res.PodDetail), res.Namespace)
+		for _, s := range sections(res, o.TimeFormat, o.Types) {
+			fmt.Fprintf(w, "\n### %s\n\n", s.title)
+			if len(s.rows) == 0 {
+				fmt.Fprintln(w, "No Data")
+				continue
+			}
+			fmt.Fprintf(w, "| %s |\n", strings.Join(s.header, " | "))
+			fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(s.header)))
+			for _, row := range s.rows {
+				cells := make([]string, len(row))
+				for i, v := range row {
+					cells[i] = markdownCell(v)
+				}
+				fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+			}
+		}
+	}
+	return nil
+}
+
+var htmlReport = template.Must(template.New("summary").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Workload summary</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #f0f0f0; }
+.ALLOW { color: #2e7d32; }
+.DENY, .BLOCK { color: #c62828; }
+.AUDIT { color: #f9a825; }
+</style>
+</head>
+<body>
+<h1>Workload summary</h1>
+<p>Generated on {{.Generated}}.</p>
+{{- range .Pods}}
+<h2>{{.Name}}</h2>
+<p>Namespace: {{.Namespace}}</p>
+{{- range .Sections}}
+<h3>{{.Title}}</h3>
+{{- if .Rows}}
+<table>
+<tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr>
+{{- range .Rows}}
+<tr>{{range .}}<td{{with .Class}} class="{{.}}"{{end}}>{{.Value}}</td>{{end}}</tr>
+{{- end}}
+</table>
+{{- else}}
+<p>No Data</p>
+{{- end}}
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// htmlCell is a cell of the HTML report, only the statuses have a Class
+type htmlCell struct {
+	Value string
+	Class string
+}
+
+// htmlRows returns the rows of a section with the class of their STATUS cell
+// set, the class colours the cell
+func htmlRows(header []string, rows [][]string) [][]htmlCell {
+	status := slices.Index(header, "STATUS")
+	out := make([][]htmlCell, len(rows))
+	for r, row := range rows {
+		out[r] = make([]htmlCell, len(row))
+		for i, v := range row {
+			out[r][i].Value = v
+			if i == status {
+				out[r][i].Class = strings.ToUpper(v)
+			}
+		}
+	}
+	return out
+}
+
+func writeHTML(w io.Writer, pods []*opb.LogsResponse, o Options) error {
+	type htmlSection struct {
+		Title  string
+		Header []string
+		Rows   [][]htmlCell
+	}
+	type htmlPod struct {
+		Name      string
+		Namespace string
+		Sections  []htmlSection
+	}
+
+	data := struct {
+		Generated string
+		Pods      []htmlPod
+	}{Generated: time.Now().Format(o.TimeFormat)}
+	for _, res := range pods {
+		pod := htmlPod{Name: res.PodDetail, Namespace: res.Namespace}
+		for _, s := range sections(res, o.TimeFormat, o.Types) {
+			pod.Sections = append(pod.Sections, htmlSection{Title: s.title, Header: s.header, Rows: htmlRows(s.header, s.rows)})
+		}
+		data.Pods = append(data.Pods, pod)
+	}
+	return htmlReport.Execute(w, data)
+}
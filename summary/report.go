@@ -0,0 +1,147 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022 Authors of KubeArmor
+
+package summary
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	opb "github.com/accuknox/auto-policy-discovery/src/protobuf/v1/observability"
+	"golang.org/x/exp/slices"
+)
+
+// DefaultTimeFormat is the layout of the last updated times
+const DefaultTimeFormat = "2006-01-02 15:04:05"
+
+// section is one of the tables of the summary of a pod
+type section struct {
+	// name identifies the table, it names the CSV files
+	name string
+	// typ is the table type selected by the Types option
+	typ    string
+	title  string
+	header []string
+	rows   [][]string
+}
+
+var (
+	sourceHeader     = []string{"SOURCE", "DESTINATION", "COUNT", "LAST UPDATED TIME", "STATUS"}
+	networkHeader    = []string{"SOURCE", "PROTOCOL", "COUNT", "LAST UPDATED TIME", "STATUS"}
+	connectionHeader = []string{"DESTINATION LABEL", "DESTINATION NAMESPACE", "PROTOCOL", "PORT", "COUNT", "LAST UPDATED TIME", "STATUS"}
+	serverConnHeader = []string{"ADDRESS-FAMILY", "PATH"}
+)
+
+func formatTime(t int64, layout string) string {
+	if layout == "" {
+		layout = DefaultTimeFormat
+	}
+	return time.Unix(t, 0).Format(layout)
+}
+
+func sourceRows(sources []*opb.ListOfSource, layout string) [][]string {
+	var rows [][]string
+	for _, src := range sources {
+		for _, dst := range src.ListOfDestination {
+			rows = append(rows, []string{
+				src.Source,
+				dst.Destination,
+				fmt.Sprint(dst.Count),
+				formatTime(dst.LastUpdatedTime, layout),
+				strings.ToUpper(dst.Status),
+			})
+		}
+	}
+	return rows
+}
+
+func connectionRows(conns []*opb.ListOfConnection, layout string) [][]string {
+	var rows [][]string
+	for _, conn := range conns {
+		rows = append(rows, []string{
+			conn.DestinationLabels,
+			conn.DestinationNamespace,
+			conn.Protocol,
+			fmt.Sprint(conn.Port),
+			fmt.Sprint(conn.Count),
+			formatTime(conn.LastUpdatedTime, layout),
+			strings.ToUpper(conn.Status),
+		})
+	}
+	return rows
+}
+
+func serverConnRows(conns []*opb.ServerConnections) [][]string {
+	var rows [][]string
+	for _, conn := range conns {
+		rows = append(rows, []string{conn.AddressFamily, conn.Path})
+	}
+	return rows
+}
+
+// sections returns the tables of the summary of a pod of the given types, or
+// of every type, in the order they are printed
+func sections(res *opb.LogsResponse, layout string, types []string) []section {
+	all := []section{
+		{
+			name:   "processes",
+			typ:    TypeProcess,
+			title:  fmt.Sprintf("List of Processes (%d)", len(res.ListOfProcess)),
+			header: sourceHeader,
+			rows:   sourceRows(res.ListOfProcess, layout),
+		},
+		{
+			name:   "files",
+			typ:    TypeFile,
+			title:  fmt.Sprintf("List of File-system accesses (%d)", len(res.ListOfFile)),
+			header: sourceHeader,
+			rows:   sourceRows(res.ListOfFile, layout),
+		},
+		{
+			name:   "network",
+			typ:    TypeNetwork,
+			title:  fmt.Sprintf("List of Network connections (%d)", len(res.ListOfNetwork)),
+			header: networkHeader,
+			rows:   sourceRows(res.ListOfNetwork, layout),
+		},
+		{
+			name:   "ingress",
+			typ:    TypeIngress,
+			title:  "Ingress Connections",
+			header: connectionHeader,
+			rows:   connectionRows(res.Ingress, layout),
+		},
+		{
+			name:   "egress",
+			typ:    TypeEgress,
+			title:  "Egress Connections",
+			header: connectionHeader,
+			rows:   connectionRows(res.Egress, layout),
+		},
+		{
+			name:   "incoming-server-connections",
+			typ:    TypeServerConn,
+			title:  fmt.Sprintf("List of Incoming server connections (%d)", len(res.InServerConn)),
+			header: serverConnHeader,
+			rows:   serverConnRows(res.InServerConn),
+		},
+		{
+			name:   "outgoing-server-connections",
+			typ:    TypeServerConn,
+			title:  fmt.Sprintf("List of Outgoing server connections (%d)", len(res.OutServerConn)),
+			header: serverConnHeader,
+			rows:   serverConnRows(res.OutServerConn),
+		},
+	}
+	if len(types) == 0 {
+		return all
+	}
+	var out []section
+	for _, s := range all {
+		if slices.Contains(types, s.typ) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022 Authors of KubeArmor
+
+package summary
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	opb "github.com/accuknox/auto-policy-discovery/src/protobuf/v1/observability"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// SaveSnapshot writes the summaries of the pods to a file, in the format of
+// the JSON output
+func SaveSnapshot(path string, pods []*opb.LogsResponse) error {
+	b, err := marshalJSON(pods)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0o600); err != nil {
+		return fmt.Errorf("unable to save the snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshot reads the summaries of the pods saved with SaveSnapshot or
+// printed with the JSON output
+func LoadSnapshot(path string) ([]*opb.LogsResponse, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the snapshot: %w", err)
+	}
+
+	var msgs []json.RawMessage
+	if err := json.Unmarshal(b, &msgs); err != nil {
+		return nil, fmt.Errorf("invalid snapshot %s: %w", path, err)
+	}
+	pods := make([]*opb.LogsResponse, 0, len(msgs))
+	for _, msg := range msgs {
+		res := &opb.LogsResponse{}
+		if err := protojson.Unmarshal(msg, res); err != nil {
+			return nil, fmt.Errorf("invalid snapshot %s: %w", path, err)
+		}
+		pods = append(pods, res)
+	}
+	return pods, nil
+}
@@ -6,47 +6,152 @@ package summary
 import (
 	"context"
 	"errors"
-	"fmt"
 	"io"
 	"os"
-	"strings"
 	"time"
 
 	opb "github.com/accuknox/auto-policy-discovery/src/protobuf/v1/observability"
-	"github.com/fatih/color"
-	"google.golang.org/grpc"
 )
 
+// DefaultServer is the discovery-engine address used when neither the GRPC
+// option nor DISCOVERY_SERVICE is set
+const DefaultServer = "localhost:9089"
+
 // Options Structure
 type Options struct {
 	GRPC      string
 	Labels    string
 	Namespace string
+	// Output is one of Outputs, table by default
+	Output string
+	// OutputDir is the directory the CSV files are written to, one per table
+	// type. CSV is written to stdout when it is not set.
+	OutputDir string
+	// TimeFormat is the layout of the last updated times
+	TimeFormat string
+	// Columns selects the columns of the tables by name
+	Columns []string
+	// Wrap wraps the cells wider than their column instead of truncating them
+	Wrap bool
+	// MaxWidth of the tables, the width of the terminal when 0 and unlimited
+	// when negative
+	MaxWidth int
+
+	// Pods selects the pods by name, as shell patterns
+	Pods []string
+	// Types selects the table types, one of Types
+	Types []string
+	// Status selects the entries by status, one of Statuses
+	Status []string
+	// Since selects the entries updated since a RFC3339 time or a duration
+	// back from now
+	Since string
+	// SortBy orders the entries of each table by decreasing count or time
+	SortBy string
+	// Top keeps the first entries of each table
+	Top int
+
+	// Save is the file the summaries are saved to, as a snapshot that can be
+	// compared later on. The snapshot holds the summaries of every pod read
+	// from discovery engine, whatever the selection.
+	Save string
+
+	// Watch refreshes the summaries every Interval until StopChan is closed
+	Watch    bool
+	Interval time.Duration
+
+	// TLS enables TLS on the connection to discovery engine, with a client
+	// certificate for mTLS when one is given
+	TLS           bool
+	TLSCACert     string
+	TLSClientCert string
+	TLSClientKey  string
+	TLSServerName string
+	// Timeout of each attempt to connect to discovery engine
+	Timeout time.Duration
+	// Retries is the number of attempts to connect after the first one
+	Retries int
 }
 
 // StartSummary : Get summary on observability data
 func StartSummary(o Options) error {
-	gRPC := ""
-
-	if o.GRPC != "" {
-		gRPC = o.GRPC
-	} else {
-		if val, ok := os.LookupEnv("DISCOVERY_SERVICE"); ok {
-			gRPC = val
-		} else {
-			gRPC = "localhost:9089"
+	if err := validateOutput(o.Output); err != nil {
+		return err
+	}
+	if o.TimeFormat == "" {
+		o.TimeFormat = DefaultTimeFormat
+	}
+
+	// the filter validates the options, it is built again on every refresh
+	// in watch mode
+	f, err := newFilter(o, time.Now())
+	if err != nil {
+		return err
+	}
+	o.Types = f.types
+
+	if o.Watch {
+		if o.Output != "" && o.Output != OutputTable {
+			return errors.New("--watch only supports the table output")
 		}
+		if o.Save != "" {
+			return errors.New("--watch can not be used with --save")
+		}
+		return watch(os.Stdout, o)
 	}
 
+	pods, err := fetchLogs(o)
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return &NoDataError{Namespace: o.Namespace, Labels: o.Labels}
+	}
+
+	// the snapshot holds every entry, the selection being applied again when
+	// comparing it
+	if o.Save != "" {
+		if err := SaveSnapshot(o.Save, pods); err != nil {
+			return err
+		}
+	}
+	return render(os.Stdout, o, f.apply(pods))
+}
+
+// FetchSummary reads the summaries of the pods from discovery engine and
+// returns the pods and entries selected by the options
+func FetchSummary(o Options) ([]*opb.LogsResponse, error) {
+	f, err := newFilter(o, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	pods, err := fetchLogs(o)
+	if err != nil {
+		return nil, err
+	}
+	return f.apply(pods), nil
+}
+
+// Select returns the pods and entries of the summaries selected by the options
+func Select(o Options, pods []*opb.LogsResponse) ([]*opb.LogsResponse, error) {
+	f, err := newFilter(o, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return f.apply(pods), nil
+}
+
+// fetchLogs reads the summaries of the pods from discovery engine
+func fetchLogs(o Options) ([]*opb.LogsResponse, error) {
 	data := &opb.LogsRequest{
 		Label:     o.Labels,
 		Namespace: o.Namespace,
 	}
 
 	// create a client
-	conn, err := grpc.Dial(gRPC, grpc.WithInsecure())
+	conn, err := connect(o)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer conn.Close()
 
@@ -55,90 +160,22 @@ func StartSummary(o Options) error {
 	//Fetch Summary Logs
 	stream, err := client.FetchLogs(context.Background(), data)
 	if err != nil {
-		return errors.New("could not connect to the server. Possible troubleshooting:\n- Check if discovery engine is running\n- Create a portforward to discovery engine service using\n\t\033[1mkubectl port-forward -n explorer service/knoxautopolicy --address 0.0.0.0 --address :: 9089:9089\033[0m")
+		return nil, &UnreachableError{Server: server(o), Err: err}
 	}
 
-	headerFmt := color.New(color.Underline).SprintfFunc()
+	var pods []*opb.LogsResponse
 	for {
 		res, err := stream.Recv()
 		if err == io.EOF {
 			break
 		}
-		if err != nil {
-			return err
-		}
-		fmt.Println("\n\n**********************************************************************")
-		fmt.Println("\nPod Name : ", res.PodDetail)
-		fmt.Println("\nNamespace : ", res.Namespace)
-		//Print List of Processes
-		fmt.Println("\nList of Processes (" + fmt.Sprint(len(res.ListOfProcess)) + ") :\n")
-		tbl := Heading("SOURCE", "DESTINATION", "COUNT", "LAST UPDATED TIME", "STATUS")
-		tbl.WithHeaderFormatter(headerFmt)
-		for _, process := range res.ListOfProcess {
-			for _, source := range process.ListOfDestination {
-				tbl.AddRow(process.Source, source.Destination, source.Count, time.Unix(source.LastUpdatedTime, 0).Format("1-02-2006 15:04:05"), strings.ToUpper(source.Status))
-			}
-		}
-		tbl.Print()
-
-		//Print List of File System
-		fmt.Println("\nList of File-system accesses (" + fmt.Sprint(len(res.ListOfFile)) + ") :\n")
-		tbl = Heading("SOURCE", "DESTINATION", "COUNT", "LAST UPDATED TIME", "STATUS")
-		tbl.WithHeaderFormatter(headerFmt)
-		for _, file := range res.ListOfFile {
-			for _, source := range file.ListOfDestination {
-				tbl.AddRow(file.Source, source.Destination, source.Count, time.Unix(source.LastUpdatedTime, 0).Format("1-02-2006 15:04:05"), strings.ToUpper(source.Status))
-			}
-		}
-		tbl.Print()
-
-		//Print List of Network Connection
-		fmt.Println("\nList of Network connections (" + fmt.Sprint(len(res.ListOfNetwork)) + ") :\n")
-		tbl = Heading("SOURCE", "Protocol", "COUNT", "LAST UPDATED TIME", "STATUS")
-		tbl.WithHeaderFormatter(headerFmt)
-		for _, network := range res.ListOfNetwork {
-			for _, source := range network.ListOfDestination {
-				tbl.AddRow(network.Source, source.Destination, source.Count, time.Unix(source.LastUpdatedTime, 0).Format("1-02-2006 15:04:05"), strings.ToUpper(source.Status))
-			}
+		if isUnreachable(err) {
+			return nil, &UnreachableError{Server: server(o), Err: err}
 		}
-		tbl.Print()
-
-		//Print Ingress Connections
-		fmt.Printf("\nIngress Connections :\n\n")
-		tbl = Heading("DESTINATION LABEL", "DESTINATION NAMESPACE", "PROTOCOL", "PORT", "COUNT", "LAST UPDATED TIME", "STATUS")
-		tbl.WithHeaderFormatter(headerFmt)
-		for _, ingress := range res.Ingress {
-			tbl.AddRow(ingress.DestinationLabels, ingress.DestinationNamespace, ingress.Protocol, ingress.Port, ingress.Count, time.Unix(ingress.LastUpdatedTime, 0).Format("1-02-2006 15:04:05"), ingress.Status)
-		}
-		tbl.Print()
-
-		//Print Egress Connections
-		fmt.Printf("\nEgress Connections : \n\n")
-		tbl = Heading("DESTINATION LABEL", "DESTINATION NAMESPACE", "PROTOCOL", "PORT", "COUNT", "LAST UPDATED TIME", "STATUS")
-		tbl.WithHeaderFormatter(headerFmt)
-		for _, egress := range res.Egress {
-			tbl.AddRow(egress.DestinationLabels, egress.DestinationNamespace, egress.Protocol, egress.Port, egress.Count, time.Unix(egress.LastUpdatedTime, 0).Format("1-02-2006 15:04:05"), egress.Status)
-		}
-		tbl.Print()
-
-		//Print System Incoming connections
-		fmt.Println("\nList of Incoming server connections (" + fmt.Sprint(len(res.InServerConn)) + ") :\n")
-		tbl = Heading("ADDRESS-FAMILY", "PATH")
-		tbl.WithHeaderFormatter(headerFmt)
-		for _, inConn := range res.InServerConn {
-			tbl.AddRow(inConn.AddressFamily, inConn.Path)
-		}
-		tbl.Print()
-
-		//Print System Outgoing connections
-		fmt.Println("\nList of Outgoing server connections (" + fmt.Sprint(len(res.OutServerConn)) + ") :\n")
-		tbl = Heading("ADDRESS-FAMILY", "PATH")
-		tbl.WithHeaderFormatter(headerFmt)
-		for _, outConn := range res.OutServerConn {
-			tbl.AddRow(outConn.AddressFamily, outConn.Path)
+		if err != nil {
+			return nil, err
 		}
-		tbl.Print()
-
+		pods = append(pods, res)
 	}
-	return nil
+	return pods, nil
 }
@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2022 Authors of KubeArmor
+
+package summary
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	opb "github.com/accuknox/auto-policy-discovery/src/protobuf/v1/observability"
+	"github.com/fatih/color"
+	"golang.org/x/term"
+)
+
+// DefaultInterval is the refresh interval of the watch mode
+const DefaultInterval = 30 * time.Second
+
+// StopChan Channel
+var (
+	StopChan chan struct{}
+)
+
+// Marks of the rows in watch mode
+const (
+	markNew     = "+"
+	markChanged = "~"
+)
+
+// highlight marks the rows that are new or whose count changed since the
+// previous refresh
+type highlight struct {
+	// prev and cur are the counts of the rows by key, prev is nil on the
+	// first refresh where nothing is highlighted
+	prev map[string]string
+	cur  map[string]string
+}
+
+func newHighlight(prev map[string]string) *highlight {
+	return &highlight{prev: prev, cur: map[string]string{}}
+}
+
+// rowKey identifies a row by its pod, its table and its cells but the count
+// and the time
+func rowKey(res *opb.LogsResponse, s section, row []string) (key, count string) {
+	parts := []string{path.Join(res.Namespace, res.PodDetail), s.name}
+	for i, c := range s.header {
+		switch c {
+		case "COUNT":
+			count = row[i]
+		case "LAST UPDATED TIME":
+		default:
+			parts = append(parts, row[i])
+		}
+	}
+	return strings.Join(parts, "\x00"), count
+}
+
+// mark prepends a column holding the mark of each row
+func (h *highlight) mark(res *opb.LogsResponse, s section) section {
+	rows := make([][]string, len(s.rows))
+	for i, row := range s.rows {
+		key, count := rowKey(res, s, row)
+		h.cur[key] = count
+
+		mark := ""
+		if h.prev != nil {
+			if prev, ok := h.prev[key]; !ok {
+				mark = markNew
+			} else if prev != count {
+				mark = markChanged
+			}
+		}
+		rows[i] = append([]string{mark}, row...)
+	}
+	s.header = append([]string{""}, s.header...)
+	s.rows = rows
+	return s
+}
+
+// formatter highlights the marked rows of a section
+func (h *highlight) formatter(s section) RowFormatter {
+	added := color.New(color.FgHiGreen, color.Bold).SprintfFunc()
+	changed := color.New(color.FgHiCyan, color.Bold).SprintfFunc()
+	return func(i int) Formatter {
+		switch s.rows[i][0] {
+		case markNew:
+			return added
+		case markChanged:
+			return changed
+		}
+		return nil
+	}
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// watch refreshes the summaries until StopChan is closed. Errors are shown
+// in place of the summaries until the next refresh succeeds. The filter is
+// built again on every refresh so that --since stays relative to now.
+func watch(w io.Writer, o Options) error {
+	interval := o.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var prev map[string]string
+	for {
+		pods, err := fetchLogs(o)
+
+		if isTerminal(w) {
+			fmt.Fprint(w, "\033[H\033[2J")
+		}
+		fmt.Fprintf(w, "Every %s: accuknox summary, %s (%s new, %s changed)\n",
+			interval, time.Now().Format(o.TimeFormat), markNew, markChanged)
+
+		if err != nil {
+			fmt.Fprintf(w, "\n%s\n", err)
+		} else {
+			f, err := newFilter(o, time.Now())
+			if err != nil {
+				return err
+			}
+			h := newHighlight(prev)
+			writeTables(w, f.apply(pods), o, h)
+			prev = h.cur
+		}
+
+		select {
+		case <-StopChan:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
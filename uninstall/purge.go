@@ -0,0 +1,221 @@
+package uninstall
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kubearmor/kubearmor-client/k8s"
+	"golang.org/x/exp/slices"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+)
+
+// discoveredPolicyPrefix is the name prefix of the policies generated by
+// discovery-engine
+const discoveredPolicyPrefix = "autopol-"
+
+// policyKinds are the policies discovery-engine generates, in the order they
+// are listed
+var policyKinds = []string{"KubeArmorPolicy", "KubeArmorHostPolicy", "CiliumNetworkPolicy"}
+
+var policyResources = map[string]schema.GroupVersionResource{
+	"KubeArmorPolicy":     {Group: "security.kubearmor.com", Version: "v1", Resource: "kubearmorpolicies"},
+	"KubeArmorHostPolicy": {Group: "security.kubearmor.com", Version: "v1", Resource: "kubearmorhostpolicies"},
+	"CiliumNetworkPolicy": {Group: "cilium.io", Version: "v2", Resource: "ciliumnetworkpolicies"},
+}
+
+// protectedNamespaces are never deleted, even with --purge
+var protectedNamespaces = []string{"default", "kube-system", "kube-public", "kube-node-lease"}
+
+// crdName returns the name of the CRD defining a policy kind
+func crdName(kind string) string {
+	gvr := policyResources[kind]
+	return gvr.Resource + "." + gvr.Group
+}
+
+func isPolicy(kind string) bool {
+	_, ok := policyResources[kind]
+	return ok
+}
+
+func policyClient(c *k8s.Client, r Resource) (dynamic.ResourceInterface, error) {
+	dyn, err := dynamic.NewForConfig(c.Config)
+	if err != nil {
+		return nil, err
+	}
+	if r.Namespace == "" {
+		return dyn.Resource(policyResources[r.Kind]), nil
+	}
+	return dyn.Resource(policyResources[r.Kind]).Namespace(r.Namespace), nil
+}
+
+// discoveredPolicies lists the policies generated by discovery-engine in every
+// namespace. Kinds whose CRD is not installed are skipped.
+func discoveredPolicies(c *k8s.Client) ([]Resource, error) {
+	dyn, err := dynamic.NewForConfig(c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	var policies []Resource
+	for _, kind := range policyKinds {
+		list, err := dyn.Resource(policyResources[kind]).List(context.Background(), metav1.ListOptions{})
+		if k8serrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to list %s objects: %w", kind, err)
+		}
+		for _, item := range list.Items {
+			if strings.HasPrefix(item.GetName(), discoveredPolicyPrefix) {
+				policies = append(policies, Resource{kind, item.GetNamespace(), item.GetName()})
+			}
+		}
+	}
+	return policies, nil
+}
+
+// ciliumCRDs lists the custom resource definitions registered by Cilium, which
+// the Cilium uninstaller leaves behind
+func ciliumCRDs(c *k8s.Client) ([]Resource, error) {
+	list, err := c.APIextClientset.ApiextensionsV1().CustomResourceDefinitions().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var crds []Resource
+	for _, crd := range list.Items {
+		if crd.Spec.Group == "cilium.io" {
+			crds = append(crds, Resource{"CustomResourceDefinition", "", crd.Name})
+		}
+	}
+	return crds, nil
+}
+
+// purgeResources lists the objects only removed with --purge
+func purgeResources(c *k8s.Client, component, ns string) ([]Resource, error) {
+	switch component {
+	case componentDiscoveryEngine:
+		policies, err := discoveredPolicies(c)
+		if err != nil {
+			return nil, err
+		}
+		return append(policies, Resource{"Namespace", "", ns}), nil
+	case componentCilium:
+		return ciliumCRDs(c)
+	}
+	return nil, nil
+}
+
+// foreignWorkloads lists the deployments and daemonsets of the namespace that
+// are not removed by the uninstall
+func foreignWorkloads(c *k8s.Client, ns string, removed []Resource) ([]string, error) {
+	ctx := context.Background()
+	var names []string
+
+	deployments, err := c.K8sClientset.AppsV1().Deployments(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deployments.Items {
+		if !slices.Contains(removed, Resource{"Deployment", ns, d.Name}) {
+			names = append(names, "Deployment "+d.Name)
+		}
+	}
+
+	daemonsets, err := c.K8sClientset.AppsV1().DaemonSets(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, ds := range daemonsets.Items {
+		if !slices.Contains(removed, Resource{"DaemonSet", ns, ds.Name}) {
+			names = append(names, "DaemonSet "+ds.Name)
+		}
+	}
+	return names, nil
+}
+
+// keepNamespaces moves the namespaces that must survive the purge from the
+// purge lists of the plan to the objects left in place
+func (p *Plan) keepNamespaces(c *k8s.Client) error {
+	var removed []Resource
+	for _, component := range p.Components {
+		removed = append(removed, component.Resources...)
+	}
+
+	for i := range p.Components {
+		component := &p.Components[i]
+		purge := component.Purge[:0]
+		for _, r := range component.Purge {
+			if r.Kind != "Namespace" {
+				purge = append(purge, r)
+				continue
+			}
+			if slices.Contains(protectedNamespaces, r.Name) {
+				p.Kept = append(p.Kept, Kept{r, "system namespace"})
+				continue
+			}
+			others, err := foreignWorkloads(c, r.Name, removed)
+			if err != nil {
+				return err
+			}
+			if len(others) > 0 {
+				p.Kept = append(p.Kept, Kept{r, "still holds " + strings.Join(others, ", ")})
+				continue
+			}
+			purge = append(purge, r)
+		}
+		component.Purge = purge
+	}
+	return nil
+}
+
+// delete removes an object listed by purgeResources. Objects already gone are
+// ignored.
+func (r Resource) delete(c *k8s.Client) error {
+	var err error
+	ctx := context.Background()
+	opts := metav1.DeleteOptions{}
+
+	switch {
+	case r.Kind == "Namespace":
+		err = c.K8sClientset.CoreV1().Namespaces().Delete(ctx, r.Name, opts)
+	case r.Kind == "CustomResourceDefinition":
+		err = c.APIextClientset.ApiextensionsV1().CustomResourceDefinitions().Delete(ctx, r.Name, opts)
+	case isPolicy(r.Kind):
+		client, cerr := policyClient(c, r)
+		if cerr != nil {
+			return cerr
+		}
+		err = client.Delete(ctx, r.Name, opts)
+	default:
+		return fmt.Errorf("unable to delete %s, unknown kind", r)
+	}
+
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// waitDeleted waits until none of the objects exist anymore, so that the
+// finalizers of namespaces and CRDs have completed
+func waitDeleted(c *k8s.Client, resources []Resource, timeout time.Duration) error {
+	err := wait.PollImmediate(2*time.Second, timeout, func() (bool, error) {
+		for _, r := range resources {
+			ok, err := r.exists(c)
+			if err != nil || ok {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("resources are still being deleted after %s", timeout)
+	}
+	return err
+}
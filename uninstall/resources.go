@@ -0,0 +1,128 @@
+package uninstall
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cilium/cilium-cli/defaults"
+	"github.com/kubearmor/kubearmor-client/k8s"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Resource is an object removed by the uninstall
+type Resource struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (r Resource) String() string {
+	if r.Namespace == "" {
+		return r.Kind + " " + r.Name
+	}
+	return fmt.Sprintf("%s %s/%s", r.Kind, r.Namespace, r.Name)
+}
+
+// exists reports whether the object is present in the cluster
+func (r Resource) exists(c *k8s.Client) (bool, error) {
+	var err error
+	ctx := context.Background()
+	opts := metav1.GetOptions{}
+
+	switch r.Kind {
+	case "Namespace":
+		_, err = c.K8sClientset.CoreV1().Namespaces().Get(ctx, r.Name, opts)
+	case "DaemonSet":
+		_, err = c.K8sClientset.AppsV1().DaemonSets(r.Namespace).Get(ctx, r.Name, opts)
+	case "Deployment":
+		_, err = c.K8sClientset.AppsV1().Deployments(r.Namespace).Get(ctx, r.Name, opts)
+	case "Service":
+		_, err = c.K8sClientset.CoreV1().Services(r.Namespace).Get(ctx, r.Name, opts)
+	case "ConfigMap":
+		_, err = c.K8sClientset.CoreV1().ConfigMaps(r.Namespace).Get(ctx, r.Name, opts)
+	case "Secret":
+		_, err = c.K8sClientset.CoreV1().Secrets(r.Namespace).Get(ctx, r.Name, opts)
+	case "ServiceAccount":
+		_, err = c.K8sClientset.CoreV1().ServiceAccounts(r.Namespace).Get(ctx, r.Name, opts)
+	case "ClusterRole":
+		_, err = c.K8sClientset.RbacV1().ClusterRoles().Get(ctx, r.Name, opts)
+	case "ClusterRoleBinding":
+		_, err = c.K8sClientset.RbacV1().ClusterRoleBindings().Get(ctx, r.Name, opts)
+	case "MutatingWebhookConfiguration":
+		_, err = c.K8sClientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, r.Name, opts)
+	case "CustomResourceDefinition":
+		_, err = c.APIextClientset.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, r.Name, opts)
+	case "KubeArmorPolicy", "KubeArmorHostPolicy", "CiliumNetworkPolicy":
+		client, cerr := policyClient(c, r)
+		if cerr != nil {
+			return false, cerr
+		}
+		_, err = client.Get(ctx, r.Name, opts)
+	default:
+		return false, fmt.Errorf("unknown kind %s", r.Kind)
+	}
+
+	if k8serrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ciliumResources lists the objects removed by the Cilium and Hubble uninstallers
+func ciliumResources(ns, helmValuesSecretName string) []Resource {
+	return []Resource{
+		{"DaemonSet", ns, defaults.AgentDaemonSetName},
+		{"Deployment", ns, defaults.OperatorDeploymentName},
+		{"Deployment", ns, defaults.RelayDeploymentName},
+		{"Service", ns, defaults.RelayDeploymentName},
+		{"ConfigMap", ns, defaults.ConfigMapName},
+		{"ConfigMap", ns, defaults.RelayConfigMapName},
+		{"ServiceAccount", ns, defaults.AgentServiceAccountName},
+		{"ServiceAccount", ns, defaults.OperatorServiceAccountName},
+		{"ServiceAccount", ns, defaults.RelayServiceAccountName},
+		{"ClusterRole", "", defaults.AgentClusterRoleName},
+		{"ClusterRole", "", defaults.OperatorClusterRoleName},
+		{"ClusterRole", "", defaults.RelayClusterRoleName},
+		{"ClusterRoleBinding", "", defaults.AgentClusterRoleName},
+		{"ClusterRoleBinding", "", defaults.OperatorClusterRoleName},
+		{"ClusterRoleBinding", "", defaults.RelayClusterRoleName},
+		{"Secret", ns, defaults.CASecretName},
+		{"Secret", ns, defaults.HubbleServerSecretName},
+		{"Secret", ns, defaults.RelayServerSecretName},
+		{"Secret", ns, defaults.RelayClientSecretName},
+		{"Secret", ns, helmValuesSecretName},
+	}
+}
+
+// kubearmorResources lists the objects removed by the KubeArmor uninstaller
+func kubearmorResources(ns string) []Resource {
+	return []Resource{
+		{"DaemonSet", ns, "kubearmor"},
+		{"Deployment", ns, "kubearmor-relay"},
+		{"Deployment", ns, "kubearmor-policy-manager"},
+		{"Deployment", ns, "kubearmor-host-policy-manager"},
+		{"Deployment", ns, "kubearmor-annotation-manager"},
+		{"Service", ns, "kubearmor"},
+		{"Service", ns, "kubearmor-policy-manager-metrics-service"},
+		{"Service", ns, "kubearmor-host-policy-manager-metrics-service"},
+		{"Service", ns, "kubearmor-annotation-manager-metrics-service"},
+		{"Secret", ns, "kubearmor-webhook-server-cert"},
+		{"ServiceAccount", ns, "kubearmor"},
+		{"ClusterRoleBinding", "", "kubearmor"},
+		{"MutatingWebhookConfiguration", "", "kubearmor-annotation-manager-metrics-service"},
+		{"CustomResourceDefinition", "", "kubearmorpolicies.security.kubearmor.com"},
+		{"CustomResourceDefinition", "", "kubearmorhostpolicies.security.kubearmor.com"},
+	}
+}
+
+// discoveryEngineResources lists the objects removed by the discovery-engine uninstaller
+func discoveryEngineResources(ns string) []Resource {
+	return []Resource{
+		{"Deployment", ns, "knoxautopolicy"},
+		{"Service", ns, "knoxautopolicy"},
+		{"ConfigMap", ns, "knoxautopolicy-config"},
+		{"ServiceAccount", ns, "knoxautopolicy"},
+		{"ClusterRoleBinding", "", "knoxautopolicy"},
+	}
+}
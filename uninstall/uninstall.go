@@ -0,0 +1,458 @@
+package uninstall
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	di "github.com/accuknox/accuknox-cli/install"
+	"github.com/accuknox/accuknox-cli/summary"
+	"github.com/cilium/cilium-cli/hubble"
+	ci "github.com/cilium/cilium-cli/install"
+	ciliumk8s "github.com/cilium/cilium-cli/k8s"
+	"github.com/fatih/color"
+	ki "github.com/kubearmor/kubearmor-client/install"
+	"github.com/kubearmor/kubearmor-client/k8s"
+	"golang.org/x/exp/slices"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Options Structure
+type Options struct {
+	// Components to remove, every component if empty
+	Components []string
+	// Namespaces of the components, detected from the deployed workloads if empty
+	CiliumNamespace          string
+	KubeArmorNamespace       string
+	DiscoveryEngineNamespace string
+
+	HelmValuesSecretName string
+	RedactHelmCertKeys   bool
+	TestNamespace        string
+	Wait                 bool
+
+	// Purge also removes the policies generated by discovery-engine, the CRDs
+	// and the discovery-engine namespace, waiting up to PurgeTimeout for them
+	// to be gone
+	Purge        bool
+	PurgeTimeout time.Duration
+
+	// Yes skips the confirmation prompt
+	Yes         bool
+	Interactive bool
+	In          io.Reader
+	Out         io.Writer
+}
+
+const (
+	componentCilium          = "cilium"
+	componentKubeArmor       = "kubearmor"
+	componentDiscoveryEngine = "discoveryengine"
+)
+
+// Components in the order they are removed
+var Components = []string{componentDiscoveryEngine, componentKubeArmor, componentCilium}
+
+// Component is a component found in the cluster and the objects the
+// uninstall removes for it
+type Component struct {
+	Name      string
+	Namespace string
+	Resources []Resource
+	// Purge lists the objects only removed with --purge
+	Purge []Resource
+	// Cascade lists the objects deleted along with their CRD, which the
+	// uninstall of some component removes, even without --purge
+	Cascade []Resource
+	// PurgeUnknown is set when the objects only removed with --purge could
+	// not be listed for lack of permissions, without --purge
+	PurgeUnknown bool
+}
+
+// Kept is an object --purge leaves in place
+type Kept struct {
+	Resource Resource
+	Reason   string
+}
+
+// Plan lists the components to remove
+type Plan struct {
+	Components []Component
+	// NotFound lists the selected components that are not installed
+	NotFound []string
+	// Kept lists the objects --purge leaves in place
+	Kept  []Kept
+	Purge bool
+}
+
+// workloadSelector identifies the main workload of each component
+var workloadSelector = map[string]struct {
+	kind     string
+	selector string
+}{
+	componentCilium:          {"DaemonSet", "k8s-app=cilium"},
+	componentKubeArmor:       {"DaemonSet", "kubearmor-app=kubearmor"},
+	componentDiscoveryEngine: {"Deployment", "deployment=knoxautopolicy"},
+}
+
+// detectNamespace finds the namespace the component was deployed to from the
+// labels of its main workload
+func detectNamespace(c *k8s.Client, component string) (string, error) {
+	ws := workloadSelector[component]
+	opts := metav1.ListOptions{LabelSelector: ws.selector}
+
+	found := map[string]bool{}
+	switch ws.kind {
+	case "DaemonSet":
+		list, err := c.K8sClientset.AppsV1().DaemonSets("").List(context.Background(), opts)
+		if err != nil {
+			return "", err
+		}
+		for _, ds := range list.Items {
+			found[ds.Namespace] = true
+		}
+	case "Deployment":
+		list, err := c.K8sClientset.AppsV1().Deployments("").List(context.Background(), opts)
+		if err != nil {
+			return "", err
+		}
+		for _, d := range list.Items {
+			found[d.Namespace] = true
+		}
+	}
+
+	namespaces := make([]string, 0, len(found))
+	for ns := range found {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	switch len(namespaces) {
+	case 0:
+		return "", nil
+	case 1:
+		return namespaces[0], nil
+	default:
+		return "", fmt.Errorf("%s is deployed in several namespaces (%s), select one with the namespace flags", component, strings.Join(namespaces, ", "))
+	}
+}
+
+func (o Options) namespace(component string) string {
+	switch component {
+	case componentCilium:
+		return o.CiliumNamespace
+	case componentKubeArmor:
+		return o.KubeArmorNamespace
+	default:
+		return o.DiscoveryEngineNamespace
+	}
+}
+
+func (o Options) resources(component, ns string) []Resource {
+	switch component {
+	case componentCilium:
+		return ciliumResources(ns, o.HelmValuesSecretName)
+	case componentKubeArmor:
+		return kubearmorResources(ns)
+	default:
+		return discoveryEngineResources(ns)
+	}
+}
+
+// GetPlan detects where the selected components are installed and lists the
+// objects the uninstall removes
+func GetPlan(c *k8s.Client, o Options) (*Plan, error) {
+	plan := &Plan{Purge: o.Purge}
+
+	for _, name := range Components {
+		if len(o.Components) > 0 && !slices.Contains(o.Components, name) {
+			continue
+		}
+
+		ns := o.namespace(name)
+		if ns == "" {
+			detected, err := detectNamespace(c, name)
+			if err != nil {
+				return nil, err
+			}
+			if detected == "" {
+				plan.NotFound = append(plan.NotFound, name)
+				continue
+			}
+			ns = detected
+		}
+
+		component := Component{Name: name, Namespace: ns}
+		for _, r := range o.resources(name, ns) {
+			ok, err := r.exists(c)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				component.Resources = append(component.Resources, r)
+			}
+		}
+		if len(component.Resources) == 0 {
+			plan.NotFound = append(plan.NotFound, name)
+			continue
+		}
+
+		// without --purge the objects are only listed in the inventory, so
+		// the uninstall does not require the permissions to list them
+		purge, err := purgeResources(c, name, ns)
+		if k8serrors.IsForbidden(err) && !o.Purge {
+			component.PurgeUnknown = true
+		} else if err != nil {
+			return nil, err
+		}
+		component.Purge = purge
+		plan.Components = append(plan.Components, component)
+	}
+
+	plan.cascade()
+	if o.Purge {
+		if err := plan.keepNamespaces(c); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// cascade moves the policies whose CRD is removed by the uninstall from the
+// purge lists of the plan to the objects deleted with their CRD
+func (p *Plan) cascade() {
+	var crds []string
+	for _, component := range p.Components {
+		for _, r := range component.Resources {
+			if r.Kind == "CustomResourceDefinition" {
+				crds = append(crds, r.Name)
+			}
+		}
+	}
+
+	for i := range p.Components {
+		component := &p.Components[i]
+		purge := component.Purge[:0]
+		for _, r := range component.Purge {
+			if isPolicy(r.Kind) && slices.Contains(crds, crdName(r.Kind)) {
+				component.Cascade = append(component.Cascade, r)
+				continue
+			}
+			purge = append(purge, r)
+		}
+		component.Purge = purge
+	}
+}
+
+// removed lists every object the uninstall deletes
+func (p *Plan) removed() []Resource {
+	var resources []Resource
+	for _, c := range p.Components {
+		resources = append(resources, c.Resources...)
+		resources = append(resources, c.Cascade...)
+		if p.Purge {
+			resources = append(resources, c.Purge...)
+		}
+	}
+	return resources
+}
+
+// Print lists every object the uninstall removes
+func (p *Plan) Print(w io.Writer) {
+	for _, name := range p.NotFound {
+		fmt.Fprintf(w, "%s is not installed, skipping\n", name)
+	}
+	if len(p.Components) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "The following resources will be deleted:\n")
+	for _, c := range p.Components {
+		fmt.Fprintf(w, "\n%s (namespace %s):\n", c.Name, c.Namespace)
+		for _, r := range c.Resources {
+			fmt.Fprintf(w, "  %s\n", r)
+		}
+		for _, r := range c.Cascade {
+			fmt.Fprintf(w, "  %s (deleted with its CRD)\n", r)
+		}
+		if p.Purge {
+			for _, r := range c.Purge {
+				fmt.Fprintf(w, "  %s (purge)\n", r)
+			}
+		}
+	}
+	if p.Purge && len(p.Kept) > 0 {
+		fmt.Fprintf(w, "\nThe following resources will be left in place:\n")
+		for _, k := range p.Kept {
+			fmt.Fprintf(w, "  %s (%s)\n", k.Resource, k.Reason)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// PrintInventory checks which of the planned objects are gone and lists what
+// was removed and what was left in place. It returns the number of objects
+// that should have been removed but still exist.
+func (p *Plan) PrintInventory(c *k8s.Client, w io.Writer) (int, error) {
+	headerFmt := color.New(color.Underline).SprintfFunc()
+	tbl := summary.Heading("COMPONENT", "RESOURCE", "RESULT", "NOTE")
+	tbl.WithHeaderFormatter(headerFmt).WithWriter(w)
+
+	left := 0
+	for _, component := range p.Components {
+		resources := append(component.Resources[:len(component.Resources):len(component.Resources)], component.Cascade...)
+		if p.Purge {
+			resources = append(resources[:len(resources):len(resources)], component.Purge...)
+		}
+		for _, r := range resources {
+			ok, err := r.exists(c)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				tbl.AddRow(component.Name, r, "LEFT IN PLACE", "deletion did not complete")
+				left++
+			} else {
+				tbl.AddRow(component.Name, r, "REMOVED", "")
+			}
+		}
+		if !p.Purge {
+			for _, r := range component.Purge {
+				tbl.AddRow(component.Name, r, "LEFT IN PLACE", "use --purge to remove")
+			}
+			if component.PurgeUnknown {
+				tbl.AddRow(component.Name, "objects removed by --purge", "UNKNOWN", "not allowed to list them")
+			}
+		}
+	}
+	if p.Purge {
+		for _, k := range p.Kept {
+			tbl.AddRow("", k.Resource, "LEFT IN PLACE", k.Reason)
+		}
+	}
+	tbl.Print()
+	return left, nil
+}
+
+// confirm asks the user whether to go ahead
+func confirm(in io.Reader, out io.Writer) (bool, error) {
+	fmt.Fprint(out, "Do you want to continue? [y/N]: ")
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// Run removes the selected components after listing what will be deleted and
+// asking for confirmation
+func Run(c *k8s.Client, cc *ciliumk8s.Client, o Options) error {
+	plan, err := GetPlan(c, o)
+	if err != nil {
+		return err
+	}
+	plan.Print(o.Out)
+	if len(plan.Components) == 0 {
+		fmt.Fprintln(o.Out, "Nothing to uninstall")
+		return nil
+	}
+
+	if !o.Yes {
+		if !o.Interactive {
+			return errors.New("refusing to uninstall without confirmation, re-run with --yes")
+		}
+		ok, err := confirm(o.In, o.Out)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintln(o.Out, "Uninstall aborted")
+			return nil
+		}
+	}
+
+	// policies go first, deleting the CRDs would remove them without their
+	// finalizers running
+	if o.Purge {
+		for _, r := range plan.removed() {
+			if isPolicy(r.Kind) {
+				if err := r.delete(c); err != nil {
+					return fmt.Errorf("unable to delete %s: %w", r, err)
+				}
+			}
+		}
+	}
+
+	for _, component := range plan.Components {
+		if err := remove(c, cc, o, component); err != nil {
+			return err
+		}
+	}
+
+	if o.Purge {
+		fmt.Fprintln(o.Out, "🔥 Purging CRDs and namespaces...")
+		for _, component := range plan.Components {
+			for _, r := range component.Purge {
+				if isPolicy(r.Kind) {
+					continue
+				}
+				if err := r.delete(c); err != nil {
+					return fmt.Errorf("unable to delete %s: %w", r, err)
+				}
+			}
+		}
+		if err := waitDeleted(c, plan.removed(), o.PurgeTimeout); err != nil {
+			fmt.Fprintf(o.Out, "WARN: %s\n", err.Error())
+		}
+	}
+
+	fmt.Fprintln(o.Out)
+	left, err := plan.PrintInventory(c, o.Out)
+	if err != nil {
+		return err
+	}
+	if left > 0 {
+		return fmt.Errorf("%d resources could not be removed", left)
+	}
+	return nil
+}
+
+func remove(c *k8s.Client, cc *ciliumk8s.Client, o Options, component Component) error {
+	switch component.Name {
+	case componentDiscoveryEngine:
+		return di.DiscoveryEngineUninstaller(c, di.Options{Namespace: component.Namespace})
+
+	case componentKubeArmor:
+		return ki.K8sUninstaller(c, ki.Options{Namespace: component.Namespace})
+
+	case componentCilium:
+		h := hubble.NewK8sHubble(cc, hubble.Parameters{
+			Namespace:            component.Namespace,
+			HelmValuesSecretName: o.HelmValuesSecretName,
+			RedactHelmCertKeys:   o.RedactHelmCertKeys,
+			Writer:               o.Out,
+		})
+		if err := h.Disable(context.Background()); err != nil {
+			return err
+		}
+		uninstaller := ci.NewK8sUninstaller(cc, ci.UninstallParameters{
+			Namespace:            component.Namespace,
+			HelmValuesSecretName: o.HelmValuesSecretName,
+			RedactHelmCertKeys:   o.RedactHelmCertKeys,
+			TestNamespace:        o.TestNamespace,
+			Wait:                 o.Wait,
+			Writer:               o.Out,
+		})
+		if err := uninstaller.Uninstall(context.Background()); err != nil {
+			return fmt.Errorf("unable to uninstall Cilium: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,413 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/accuknox/accuknox-cli/summary"
+	"github.com/blang/semver"
+	"github.com/cilium/cilium-cli/defaults"
+	ci "github.com/cilium/cilium-cli/install"
+	ciliumk8s "github.com/cilium/cilium-cli/k8s"
+	"github.com/fatih/color"
+	"github.com/kubearmor/kubearmor-client/k8s"
+	"golang.org/x/exp/slices"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Options Structure
+type Options struct {
+	Namespace                string
+	DiscoveryEngineNamespace string
+	HelmValuesSecretName     string
+	CiliumVersion            string
+	KubeArmorImage           string
+	DiscoveryEngineImage     string
+	Disable                  []string
+	WaitDuration             time.Duration
+	PlanOnly                 bool
+	AllowDowngrade           bool
+	Writer                   io.Writer
+}
+
+// Action planned for a component
+type Action string
+
+const (
+	// Upgrade rolls the component forward to the target version
+	Upgrade Action = "UPGRADE"
+	// Downgrade rolls the component back to an older target version
+	Downgrade Action = "DOWNGRADE"
+	// Replace switches the component to the image of another repository
+	Replace Action = "REPLACE"
+	// UpToDate means the component already runs the target version
+	UpToDate Action = "UP TO DATE"
+	// NotInstalled means the component was not found in the cluster
+	NotInstalled Action = "NOT INSTALLED"
+	// Skipped means the component was disabled
+	Skipped Action = "SKIPPED"
+)
+
+// Step of the upgrade plan
+type Step struct {
+	Component string
+	Current   string
+	Target    string
+	Action    Action
+}
+
+// Plan lists the steps of an upgrade in the order they are applied
+type Plan struct {
+	Steps []Step
+}
+
+const (
+	componentCilium          = "cilium"
+	componentHubbleRelay     = "hubble-relay"
+	componentKubeArmor       = "kubearmor"
+	componentDiscoveryEngine = "discoveryengine"
+)
+
+// workloads rolled out by the upgrade of each component
+func (o Options) workloads(component string) []workload {
+	switch component {
+	case componentCilium:
+		return []workload{
+			{kind: kindDaemonSet, namespace: o.Namespace, name: defaults.AgentDaemonSetName},
+			{kind: kindDeployment, namespace: o.Namespace, name: defaults.OperatorDeploymentName},
+		}
+	case componentHubbleRelay:
+		return []workload{{kind: kindDeployment, namespace: o.Namespace, name: defaults.RelayDeploymentName}}
+	case componentKubeArmor:
+		return []workload{{kind: kindDaemonSet, namespace: o.Namespace, name: "kubearmor"}}
+	case componentDiscoveryEngine:
+		return []workload{{kind: kindDeployment, namespace: o.DiscoveryEngineNamespace, name: "knoxautopolicy"}}
+	}
+	return nil
+}
+
+// GetPlan detects the installed version of every component and compares it to
+// the target version
+func GetPlan(c *k8s.Client, o Options) (*Plan, error) {
+	plan := &Plan{}
+
+	// hubble-relay is not upgraded by the Cilium installer, it is rolled to
+	// the Cilium version on its own and disabled along with Cilium
+	detectors := []struct {
+		component string
+		disable   string
+		target    string
+		detect    func() (string, error)
+		compare   func(current, target string) Action
+	}{
+		{componentCilium, componentCilium, o.CiliumVersion, func() (string, error) { return ciliumVersion(c, o) }, compareVersions},
+		{componentHubbleRelay, componentCilium, o.CiliumVersion, func() (string, error) { return relayVersion(c, o) }, compareVersions},
+		{componentKubeArmor, componentKubeArmor, o.KubeArmorImage, func() (string, error) { return containerImage(c, o.workloads(componentKubeArmor)[0], "kubearmor") }, compareImages},
+		{componentDiscoveryEngine, componentDiscoveryEngine, o.DiscoveryEngineImage, func() (string, error) {
+			return containerImage(c, o.workloads(componentDiscoveryEngine)[0], "knoxautopolicy")
+		}, compareImages},
+	}
+
+	for _, d := range detectors {
+		step := Step{Component: d.component, Target: d.target}
+		if slices.Contains(o.Disable, d.disable) {
+			step.Action = Skipped
+			plan.Steps = append(plan.Steps, step)
+			continue
+		}
+
+		current, err := d.detect()
+		if err != nil {
+			return nil, fmt.Errorf("unable to detect the installed %s version: %w", d.component, err)
+		}
+		step.Current = current
+		if current == "" {
+			step.Action = NotInstalled
+		} else {
+			step.Action = d.compare(current, d.target)
+		}
+		plan.Steps = append(plan.Steps, step)
+	}
+
+	return plan, nil
+}
+
+// ciliumVersion reads the image tag from the helm values secret written at
+// install time, falling back to the tag of the agent image
+func ciliumVersion(c *k8s.Client, o Options) (string, error) {
+	secret, err := c.K8sClientset.CoreV1().Secrets(o.Namespace).Get(context.Background(), o.HelmValuesSecretName, metav1.GetOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return "", err
+	}
+	if err == nil {
+		values := map[string]interface{}{}
+		if err := yaml.Unmarshal(secret.Data[defaults.HelmValuesSecretKeyName], &values); err != nil {
+			return "", fmt.Errorf("invalid helm values in secret %s/%s: %w", o.Namespace, o.HelmValuesSecretName, err)
+		}
+		if image, ok := values["image"].(map[string]interface{}); ok {
+			if tag, ok := image["tag"].(string); ok && tag != "" {
+				return tag, nil
+			}
+		}
+	}
+
+	image, err := containerImage(c, o.workloads(componentCilium)[0], "cilium-agent")
+	if err != nil || image == "" {
+		return "", err
+	}
+	return imageTag(image), nil
+}
+
+// relayVersion returns the tag of the hubble-relay image
+func relayVersion(c *k8s.Client, o Options) (string, error) {
+	image, err := containerImage(c, o.workloads(componentHubbleRelay)[0], defaults.RelayContainerName)
+	if err != nil || image == "" {
+		return "", err
+	}
+	return imageTag(image), nil
+}
+
+// relayImage returns the hubble-relay image of a Cilium version, from the
+// repository of the current image
+func relayImage(current, version string) string {
+	repo := defaults.RelayImage
+	if current != "" {
+		repo = imageName(current)
+	}
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	return repo + ":" + version
+}
+
+// containerImage returns the image of the container of the workload, or an
+// empty string if the workload does not exist
+func containerImage(c *k8s.Client, w workload, container string) (string, error) {
+	t, err := w.template(c)
+	if k8serrors.IsNotFound(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	for _, ct := range t.Spec.Containers {
+		if ct.Name == container {
+			return ct.Image, nil
+		}
+	}
+	if len(t.Spec.Containers) > 0 {
+		return t.Spec.Containers[0].Image, nil
+	}
+	return "", nil
+}
+
+// imageTag strips the repository and digest of an image reference
+func imageTag(image string) string {
+	image = strings.SplitN(image, "@", 2)[0]
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return "latest"
+}
+
+// imageName strips the tag and digest of an image reference
+func imageName(image string) string {
+	image = strings.SplitN(image, "@", 2)[0]
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i]
+	}
+	return image
+}
+
+// imageRepository strips the tag and digest of an image reference, and the
+// implicit docker.io registry and library namespace
+func imageRepository(image string) string {
+	image = strings.TrimPrefix(imageName(image), "docker.io/")
+	return strings.TrimPrefix(image, "library/")
+}
+
+func compareVersions(current, target string) Action {
+	if current == target {
+		return UpToDate
+	}
+	cv, cerr := semver.ParseTolerant(current)
+	tv, terr := semver.ParseTolerant(target)
+	if cerr == nil && terr == nil {
+		switch {
+		case tv.Equals(cv):
+			return UpToDate
+		case tv.LT(cv):
+			return Downgrade
+		}
+	}
+	return Upgrade
+}
+
+func compareImages(current, target string) Action {
+	if current == target {
+		return UpToDate
+	}
+	if imageRepository(current) != imageRepository(target) {
+		return Replace
+	}
+	return compareVersions(imageTag(current), imageTag(target))
+}
+
+// Print renders the plan as a table
+func (p *Plan) Print() {
+	headerFmt := color.New(color.Underline).SprintfFunc()
+	tbl := summary.Heading("COMPONENT", "CURRENT", "TARGET", "ACTION")
+	tbl.WithHeaderFormatter(headerFmt)
+	for _, s := range p.Steps {
+		current := s.Current
+		if current == "" {
+			current = "-"
+		}
+		tbl.AddRow(s.Component, current, s.Target, s.Action)
+	}
+	tbl.Print()
+}
+
+// Run shows the upgrade plan and rolls every component forward in turn,
+// waiting for it to become ready before moving to the next one. A component
+// that does not become ready is rolled back and the upgrade stops.
+func Run(c *k8s.Client, cc *ciliumk8s.Client, o Options) error {
+	plan, err := GetPlan(c, o)
+	if err != nil {
+		return err
+	}
+	plan.Print()
+
+	if o.PlanOnly {
+		return nil
+	}
+
+	for _, s := range plan.Steps {
+		if s.Action == Downgrade && !o.AllowDowngrade {
+			return fmt.Errorf("refusing to downgrade %s from %s to %s, re-run with --allow-downgrade", s.Component, s.Current, s.Target)
+		}
+	}
+
+	upgraded := 0
+	for _, s := range plan.Steps {
+		if s.Action != Upgrade && s.Action != Downgrade && s.Action != Replace {
+			continue
+		}
+		fmt.Fprintf(o.Writer, "\n🚀 Upgrading %s from %s to %s...\n", s.Component, s.Current, s.Target)
+		if err := upgradeComponent(c, cc, o, s); err != nil {
+			return err
+		}
+		fmt.Fprintf(o.Writer, "✅ %s is ready on %s\n", s.Component, s.Target)
+		upgraded++
+	}
+
+	if upgraded == 0 {
+		fmt.Fprintf(o.Writer, "\nNothing to upgrade\n")
+	}
+	return nil
+}
+
+func upgradeComponent(c *k8s.Client, cc *ciliumk8s.Client, o Options, s Step) error {
+	workloads := o.workloads(s.Component)
+
+	// the pod templates are kept to roll back to
+	previous := make([]*corev1.PodTemplateSpec, len(workloads))
+	for i, w := range workloads {
+		t, err := w.template(c)
+		if err != nil {
+			return err
+		}
+		previous[i] = t
+	}
+
+	err := rollForward(c, cc, o, s)
+	if err == nil {
+		err = waitReady(c, workloads, o.WaitDuration)
+	}
+	if err == nil {
+		if s.Component == componentCilium {
+			return setCiliumVersion(c, o)
+		}
+		return nil
+	}
+
+	fmt.Fprintf(o.Writer, "❌ %s failed to upgrade: %s\n", s.Component, err.Error())
+	fmt.Fprintf(o.Writer, "⏪ Rolling %s back to %s...\n", s.Component, s.Current)
+	for i, w := range workloads {
+		if rerr := w.setTemplate(c, *previous[i]); rerr != nil {
+			return fmt.Errorf("%s failed to upgrade (%w) and could not be rolled back: %s", s.Component, err, rerr.Error())
+		}
+	}
+	if rerr := waitReady(c, workloads, o.WaitDuration); rerr != nil {
+		return fmt.Errorf("%s failed to upgrade (%w) and is not ready after the rollback: %s", s.Component, err, rerr.Error())
+	}
+	return fmt.Errorf("%s failed to upgrade and was rolled back to %s: %w", s.Component, s.Current, err)
+}
+
+func rollForward(c *k8s.Client, cc *ciliumk8s.Client, o Options, s Step) error {
+	switch s.Component {
+	case componentCilium:
+		installer, err := ci.NewK8sInstaller(cc, ci.Parameters{
+			Namespace:            o.Namespace,
+			Version:              s.Target,
+			HelmValuesSecretName: o.HelmValuesSecretName,
+			Writer:               o.Writer,
+		})
+		if err != nil {
+			return err
+		}
+		return installer.Upgrade(context.Background())
+
+	case componentHubbleRelay:
+		w := o.workloads(s.Component)[0]
+		current, err := containerImage(c, w, defaults.RelayContainerName)
+		if err != nil {
+			return err
+		}
+		return w.setImage(c, defaults.RelayContainerName, relayImage(current, s.Target))
+
+	case componentKubeArmor:
+		return o.workloads(s.Component)[0].setImage(c, "kubearmor", s.Target)
+
+	case componentDiscoveryEngine:
+		return o.workloads(s.Component)[0].setImage(c, "knoxautopolicy", s.Target)
+	}
+	return errors.New("unknown component " + s.Component)
+}
+
+// setCiliumVersion records the new version in the helm values secret so that
+// later upgrades detect it
+func setCiliumVersion(c *k8s.Client, o Options) error {
+	secrets := c.K8sClientset.CoreV1().Secrets(o.Namespace)
+	secret, err := secrets.Get(context.Background(), o.HelmValuesSecretName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(secret.Data[defaults.HelmValuesSecretKeyName], &values); err != nil {
+		return err
+	}
+	image, ok := values["image"].(map[string]interface{})
+	if !ok {
+		image = map[string]interface{}{}
+		values["image"] = image
+	}
+	image["tag"] = o.CiliumVersion
+
+	b, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+	secret.Data[defaults.HelmValuesSecretKeyName] = b
+	_, err = secrets.Update(context.Background(), secret, metav1.UpdateOptions{})
+	return err
+}
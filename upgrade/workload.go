@@ -0,0 +1,145 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kubearmor/kubearmor-client/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	kindDaemonSet  = "DaemonSet"
+	kindDeployment = "Deployment"
+)
+
+// workload is a daemonset or deployment rolled out by an upgrade
+type workload struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+func (w workload) String() string {
+	return fmt.Sprintf("%s %s/%s", w.kind, w.namespace, w.name)
+}
+
+func (w workload) template(c *k8s.Client) (*corev1.PodTemplateSpec, error) {
+	switch w.kind {
+	case kindDaemonSet:
+		ds, err := c.K8sClientset.AppsV1().DaemonSets(w.namespace).Get(context.Background(), w.name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &ds.Spec.Template, nil
+	default:
+		d, err := c.K8sClientset.AppsV1().Deployments(w.namespace).Get(context.Background(), w.name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return &d.Spec.Template, nil
+	}
+}
+
+// update applies fn to the pod template of the workload, retrying on conflicts
+func (w workload) update(c *k8s.Client, fn func(t *corev1.PodTemplateSpec)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		switch w.kind {
+		case kindDaemonSet:
+			client := c.K8sClientset.AppsV1().DaemonSets(w.namespace)
+			ds, err := client.Get(context.Background(), w.name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			fn(&ds.Spec.Template)
+			_, err = client.Update(context.Background(), ds, metav1.UpdateOptions{})
+			return err
+		default:
+			client := c.K8sClientset.AppsV1().Deployments(w.namespace)
+			d, err := client.Get(context.Background(), w.name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			fn(&d.Spec.Template)
+			_, err = client.Update(context.Background(), d, metav1.UpdateOptions{})
+			return err
+		}
+	})
+}
+
+func (w workload) setTemplate(c *k8s.Client, t corev1.PodTemplateSpec) error {
+	return w.update(c, func(current *corev1.PodTemplateSpec) {
+		*current = t
+	})
+}
+
+func (w workload) setImage(c *k8s.Client, container, image string) error {
+	found := false
+	err := w.update(c, func(t *corev1.PodTemplateSpec) {
+		for i := range t.Spec.Containers {
+			if t.Spec.Containers[i].Name == container {
+				t.Spec.Containers[i].Image = image
+				found = true
+			}
+		}
+	})
+	if err == nil && !found {
+		return fmt.Errorf("%s has no container %s", w, container)
+	}
+	return err
+}
+
+// ready reports whether every replica runs the latest pod template and is
+// available
+func (w workload) ready(c *k8s.Client) (bool, error) {
+	switch w.kind {
+	case kindDaemonSet:
+		ds, err := c.K8sClientset.AppsV1().DaemonSets(w.namespace).Get(context.Background(), w.name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		s := ds.Status
+		return s.ObservedGeneration >= ds.Generation &&
+			s.UpdatedNumberScheduled == s.DesiredNumberScheduled &&
+			s.NumberAvailable == s.DesiredNumberScheduled &&
+			s.NumberUnavailable == 0, nil
+	default:
+		d, err := c.K8sClientset.AppsV1().Deployments(w.namespace).Get(context.Background(), w.name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		s := d.Status
+		replicas := deploymentReplicas(d)
+		return s.ObservedGeneration >= d.Generation &&
+			s.UpdatedReplicas == replicas &&
+			s.AvailableReplicas == replicas &&
+			s.Replicas == replicas, nil
+	}
+}
+
+func deploymentReplicas(d *appsv1.Deployment) int32 {
+	if d.Spec.Replicas == nil {
+		return 1
+	}
+	return *d.Spec.Replicas
+}
+
+// waitReady waits until every workload has rolled out
+func waitReady(c *k8s.Client, workloads []workload, timeout time.Duration) error {
+	for _, w := range workloads {
+		err := wait.PollImmediate(2*time.Second, timeout, func() (bool, error) {
+			return w.ready(c)
+		})
+		if err == wait.ErrWaitTimeout {
+			return fmt.Errorf("%s did not become ready within %s", w, timeout)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}